@@ -2,251 +2,500 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-audio/audio"
-	"github.com/go-audio/wav"
+	"github.com/vadiminshakov/storyshort/gui"
 )
 
 type OpenAIProcessor struct {
-	config *Config
+	config   *Config
+	progress chan gui.TranscriptionProgress
 }
 
 func NewOpenAIProcessor(config *Config) *OpenAIProcessor {
-	return &OpenAIProcessor{config: config}
+	return &OpenAIProcessor{config: config, progress: make(chan gui.TranscriptionProgress, 32)}
 }
 
-type openAITranscriptionResponse struct {
-	Text string `json:"text"`
+// Progress returns a report for every chunk of a long recording that has
+// been transcribed. The channel stays open for the processor's life.
+func (p *OpenAIProcessor) Progress() <-chan gui.TranscriptionProgress {
+	return p.progress
 }
 
+func (p *OpenAIProcessor) reportProgress(progress gui.TranscriptionProgress) {
+	select {
+	case p.progress <- progress:
+	default:
+		// nobody is listening, or not fast enough
+	}
+}
+
+// transcriptSegment is a piece of transcript with its position in the audio,
+// in seconds. Models that don't report timestamps yield a single segment per
+// request starting at the beginning of the uploaded file.
+type transcriptSegment struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Text    string  `json:"text"`
+	Speaker string  `json:"speaker,omitempty"`
+}
+
+const (
+	chunkDurationMinutes = 3
+	speakerLabelPrompt   = "Separate speech from different speakers and label each speaker as 'Speaker 1:', 'Speaker 2:', etc."
+	// stands in for the summary when there is no API key to write one with
+	noSummaryNote = "No summary was written, as no API key is set. The transcript is in transcript.txt."
+)
+
 func (p *OpenAIProcessor) ProcessAudio(audioFile, outputDir, language, model string, startTime time.Time) (summary, title, finalAudioPath string, err error) {
-	apiKey := p.config.GetOpenAIAPIKey()
-	if apiKey == "" {
-		return "", "", "", fmt.Errorf("OpenAI API key is required")
+	if !p.config.CanTranscribe(model) {
+		return "", "", "", fmt.Errorf("OpenAI API key is required to transcribe with %s", model)
 	}
 
-	fmt.Printf("DEBUG: Starting transcription for file: %s\n", audioFile)
-	
-	transcript, err := p.transcribeAudio(audioFile, language, model)
+	// progress is checkpointed next to the audio file so an interrupted run
+	// can be resumed from its last completed step
+	workDir := filepath.Dir(audioFile)
+	state, err := loadSessionState(workDir)
 	if err != nil {
-		return "", "", "", fmt.Errorf("transcription failed: %w", err)
+		return "", "", "", fmt.Errorf("failed to load session state: %w", err)
+	}
+	if state.AudioFile == "" {
+		state.StartTime = startTime
+		state.AudioFile = filepath.Base(audioFile)
+		if err := state.save(workDir); err != nil {
+			fmt.Printf("Warning: failed to save session state: %v\n", err)
+		}
+	}
+
+	// segments are checkpointed alongside the text so that markers can still
+	// be aligned when an interrupted run is resumed
+	transcriptCheckpoint := filepath.Join(workDir, "transcript.txt")
+	segmentsCheckpoint := filepath.Join(workDir, "transcript.json")
+	var segments []transcriptSegment
+	if data, err := os.ReadFile(transcriptCheckpoint); err == nil && len(data) > 0 {
+		fmt.Printf("DEBUG: Reusing transcript from previous run\n")
+		if data, err := os.ReadFile(segmentsCheckpoint); err == nil {
+			json.Unmarshal(data, &segments)
+		}
+		if len(segments) == 0 {
+			segments = []transcriptSegment{{Text: string(data)}}
+		}
+	} else {
+		fmt.Printf("DEBUG: Starting transcription for file: %s\n", audioFile)
+
+		micTrack, systemTrack := findTrack(workDir, micTrackName), findTrack(workDir, systemTrackName)
+		if micTrack != "" && systemTrack != "" {
+			segments, err = p.transcribeTracks(workDir, micTrack, systemTrack, language, model)
+		} else {
+			segments, err = p.transcribeTrack(workDir, recordingTrackName, audioFile, language, model)
+		}
+		if err != nil {
+			return "", "", "", fmt.Errorf("transcription failed: %w", err)
+		}
+
+		if segmentsText(segments) == "" {
+			return "", "", "", fmt.Errorf("empty transcript received")
+		}
+
+		if data, err := json.Marshal(segments); err == nil {
+			if err := os.WriteFile(segmentsCheckpoint, data, 0644); err != nil {
+				fmt.Printf("Warning: failed to checkpoint transcript segments: %v\n", err)
+			}
+		}
+		if err := os.WriteFile(transcriptCheckpoint, []byte(segmentsText(segments)), 0644); err != nil {
+			fmt.Printf("Warning: failed to checkpoint transcript: %v\n", err)
+		}
 	}
+	transcript := segmentsText(segments)
 
-	if transcript == "" {
-		return "", "", "", fmt.Errorf("empty transcript received")
+	// the metadata moves into the session directory with the recording
+	var markers []markerNote
+	for _, dir := range []string{workDir, state.SessionDir} {
+		if metadata, err := loadSessionMetadata(filepath.Join(dir, sessionMetadataFile)); err == nil {
+			markers = alignMarkers(metadata.Markers, segments)
+			break
+		}
 	}
 
-	summary, title, err = p.generateSummary(transcript)
-	if err != nil {
-		return "", "", "", fmt.Errorf("summary generation failed: %w", err)
+	if state.Title == "" && !p.config.CanSummarize() {
+		// transcribed locally with no key for the summary
+		fmt.Printf("DEBUG: No API key for the chat endpoint, skipping the summary\n")
+
+		state.Title, state.Summary = "meeting_transcript", noSummaryNote
+		if err := state.save(workDir); err != nil {
+			fmt.Printf("Warning: failed to save session state: %v\n", err)
+		}
 	}
 
-	fmt.Printf("DEBUG: Summary generation successful\n")
+	if state.Title == "" {
+		summary, title, err = p.generateSummary(transcript, formatMarkers(markers))
+		if err != nil {
+			return "", "", "", fmt.Errorf("summary generation failed: %w", err)
+		}
 
-	sessionDir, err := createSessionDir(outputDir, title, startTime)
-	if err != nil {
-		return "", "", "", fmt.Errorf("failed to create session directory: %w", err)
+		fmt.Printf("DEBUG: Summary generation successful\n")
+
+		state.Title, state.Summary = title, summary
+		if err := state.save(workDir); err != nil {
+			fmt.Printf("Warning: failed to save session state: %v\n", err)
+		}
+	}
+
+	if state.SessionDir == "" {
+		sessionDir, err := createSessionDir(outputDir, state.Title, startTime)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to create session directory: %w", err)
+		}
+
+		state.SessionDir = sessionDir
+		if err := state.save(workDir); err != nil {
+			fmt.Printf("Warning: failed to save session state: %v\n", err)
+		}
 	}
 
-	finalAudioPath = filepath.Join(sessionDir, "recording.wav")
-	if err := os.Rename(audioFile, finalAudioPath); err != nil {
-		return "", "", "", fmt.Errorf("failed to move audio file: %w", err)
+	finalAudioPath = filepath.Join(state.SessionDir, "recording.wav")
+	if _, err := os.Stat(finalAudioPath); os.IsNotExist(err) {
+		if err := moveFile(audioFile, finalAudioPath); err != nil {
+			return "", "", "", fmt.Errorf("failed to move audio file: %w", err)
+		}
+	}
+
+	// cleaned up versions and quality reports are kept next to the originals
+	// they were made from
+	extraFiles := []string{findTrack(workDir, micTrackName), findTrack(workDir, systemTrackName), filepath.Join(workDir, sessionMetadataFile)}
+	for _, original := range []string{audioFile, extraFiles[0], extraFiles[1]} {
+		if original != "" {
+			extraFiles = append(extraFiles, findCleanVersion(original), qualityReportPath(original))
+		}
+	}
+	for _, extraFile := range extraFiles {
+		if extraFile == "" || !fileExists(extraFile) {
+			continue
+		}
+		if err := moveFile(extraFile, filepath.Join(state.SessionDir, filepath.Base(extraFile))); err != nil {
+			fmt.Printf("Warning: failed to move %s: %v\n", filepath.Base(extraFile), err)
+		}
 	}
 
-	transcriptPath := filepath.Join(sessionDir, "transcript.txt")
+	transcriptPath := filepath.Join(state.SessionDir, "transcript.txt")
 	if err := os.WriteFile(transcriptPath, []byte(transcript), 0644); err != nil {
 		fmt.Printf("Warning: failed to save transcript: %v\n", err)
 	}
 
-	return summary, title, finalAudioPath, nil
+	if len(markers) > 0 {
+		markersPath := filepath.Join(state.SessionDir, markersFile)
+		if err := os.WriteFile(markersPath, []byte(formatMarkers(markers)), 0644); err != nil {
+			fmt.Printf("Warning: failed to save markers: %v\n", err)
+		}
+	}
+
+	return state.Summary, state.Title, finalAudioPath, nil
 }
 
-func (p *OpenAIProcessor) transcribeAudio(audioFile, language, model string) (string, error) {
+func (p *OpenAIProcessor) transcribeAudio(audioFile, language, model, prompt string) ([]transcriptSegment, error) {
+	transcriber, err := p.transcriber(model)
+	if err != nil {
+		return nil, err
+	}
+
 	fileInfo, err := os.Stat(audioFile)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	
-	const maxFileSize = 25 * 1024 * 1024 // 25MB limit
-	
-	if fileInfo.Size() <= maxFileSize {
-		return p.transcribeAudioChunk(audioFile, language, model)
+	maxFileSize := transcriber.MaxFileSize()
+	if maxFileSize == 0 || fileInfo.Size() <= maxFileSize {
+		return transcriber.Transcribe(context.Background(), audioFile, language, prompt)
 	}
 	
 	fmt.Printf("DEBUG: Large audio file detected (%d bytes), chunking required\n", fileInfo.Size())
 	
 	// for large files, we need to split the audio
-	chunks, err := p.splitAudioFile(audioFile)
+	chunks, err := splitAudioFile(audioFile, maxFileSize)
 	if err != nil {
-		return "", fmt.Errorf("failed to split audio: %w", err)
+		return nil, fmt.Errorf("failed to split audio: %w", err)
 	}
 	
-	var transcripts []string
-	for i, chunk := range chunks {
-		fmt.Printf("DEBUG: Transcribing chunk %d/%d\n", i+1, len(chunks))
-		transcript, err := p.transcribeAudioChunk(chunk, language, model)
-		if err != nil {
-			return "", fmt.Errorf("failed to transcribe chunk %d: %w", i+1, err)
+	return p.transcribeChunks(transcriber, audioFile, chunks, language, prompt)
+}
+
+// transcribeChunks transcribes chunks of audioFile, up to the configured
+// number at a time, and joins their segments in order. The first failure
+// cancels the chunks still uploading and stops those that haven't started;
+// chunks finished by then are checkpointed for the next attempt.
+func (p *OpenAIProcessor) transcribeChunks(transcriber Transcriber, audioFile string, chunks []audioChunk, language, prompt string) ([]transcriptSegment, error) {
+	defer removeChunks(chunks)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([][]transcriptSegment, len(chunks))
+	next := make(chan int)
+	var mu sync.Mutex
+	var firstErr error
+	done := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(p.config.GetTranscriptionConcurrency(), len(chunks)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				chunkSegments, err := transcribeChunk(ctx, transcriber, chunks[i], i, len(chunks), language, prompt)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else {
+					results[i] = chunkSegments
+					done++
+					p.reportProgress(gui.TranscriptionProgress{File: filepath.Base(audioFile), Chunk: i + 1, Done: done, Total: len(chunks)})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for i := range chunks {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break dispatch
 		}
-		transcripts = append(transcripts, transcript)
-		
-		// clean up temporary chunk file
-		os.Remove(chunk)
 	}
-	
-	return strings.Join(transcripts, " "), nil
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	var segments []transcriptSegment
+	for i, chunkSegments := range results {
+		from, until := chunkBounds(chunks, i)
+		segments = append(segments, segmentsWithin(chunkSegments, from, until)...)
+	}
+	return segments, nil
 }
 
-func (p *OpenAIProcessor) transcribeAudioChunk(audioFile, language, model string) (string, error) {
-	file, err := os.Open(audioFile)
+// chunkCheckpoint is the transcript of a chunk saved for the next attempt,
+// with the stretch of the recording it covers. Another attempt may cut the
+// chunks differently, so it is only reused for a chunk cut the same way.
+type chunkCheckpoint struct {
+	Start    float64             `json:"start"`
+	Length   float64             `json:"length"`
+	Segments []transcriptSegment `json:"segments"`
+}
+
+// transcribeChunk transcribes chunk i of n with timestamps in the whole
+// recording. Chunks finished by an interrupted run are not uploaded again.
+func transcribeChunk(ctx context.Context, transcriber Transcriber, chunk audioChunk, i, n int, language, prompt string) ([]transcriptSegment, error) {
+	// the chunk file is only needed until its transcript is saved
+	defer os.Remove(chunk.Path)
+
+	checkpoint := strings.TrimSuffix(chunk.Path, filepath.Ext(chunk.Path)) + ".json"
+	if data, err := os.ReadFile(checkpoint); err == nil {
+		var saved chunkCheckpoint
+		if err := json.Unmarshal(data, &saved); err == nil && saved.Start == chunk.Start && saved.Length == chunk.Length {
+			fmt.Printf("DEBUG: Reusing transcript for chunk %d/%d\n", i+1, n)
+			return saved.Segments, nil
+		}
+	}
+
+	fmt.Printf("DEBUG: Transcribing chunk %d/%d\n", i+1, n)
+	segments, err := transcriber.Transcribe(ctx, chunk.Path, language, prompt)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to transcribe chunk %d: %w", i+1, err)
+	}
+	for j := range segments {
+		segments[j].Start += chunk.Start
+		segments[j].End += chunk.Start
 	}
-	defer file.Close()
 
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
+	if data, err := json.Marshal(chunkCheckpoint{Start: chunk.Start, Length: chunk.Length, Segments: segments}); err == nil {
+		if err := os.WriteFile(checkpoint, data, 0644); err != nil {
+			fmt.Printf("Warning: failed to checkpoint chunk %d: %v\n", i+1, err)
+		}
+	}
+	return segments, nil
+}
 
-	part, err := writer.CreateFormFile("file", filepath.Base(audioFile))
+// transcribeRecording transcribes audioFile, uploading its silence-trimmed
+// version when there is one and mapping the timestamps back to the original.
+// Otherwise its cleaned up version is preferred.
+func (p *OpenAIProcessor) transcribeRecording(audioFile, language, model, prompt string) ([]transcriptSegment, error) {
+	speechFile, offsets := findSpeechVersion(audioFile)
+	if speechFile == "" {
+		if cleanFile := findCleanVersion(audioFile); cleanFile != "" {
+			audioFile = cleanFile
+		}
+		return p.transcribeAudio(audioFile, language, model, prompt)
+	}
+
+	segments, err := p.transcribeAudio(speechFile, language, model, prompt)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	offsets.remap(segments)
+	return segments, nil
+}
 
-	if _, err := io.Copy(part, file); err != nil {
-		return "", err
+// transcribeTrack transcribes one track of the recording in workDir. A track
+// that was cut into segments while recording is transcribed segment by
+// segment, reusing the ones already transcribed in the background.
+func (p *OpenAIProcessor) transcribeTrack(workDir, track, audioFile, language, model string) ([]transcriptSegment, error) {
+	dir := filepath.Join(workDir, segmentsDirName)
+	live, err := loadSegments(dir)
+	if err != nil {
+		fmt.Printf("Warning: ignoring live segments: %v\n", err)
 	}
 
-	writer.WriteField("model", model)
-	if language != "auto" {
-		writer.WriteField("language", language)
+	trackSegments := segmentsForTrack(live, track)
+	if len(trackSegments) == 0 {
+		return p.transcribeRecording(audioFile, language, model, trackPrompt(track))
 	}
-	
-	writer.WriteField("prompt", "Separate speech from different speakers and label each speaker as 'Speaker 1:', 'Speaker 2:', etc.")
-	writer.Close()
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/audio/transcriptions", &requestBody)
-	if err != nil {
-		return "", err
+	var segments []transcriptSegment
+	for i, segment := range trackSegments {
+		fmt.Printf("DEBUG: Transcribing segment %d/%d of %s\n", i+1, len(trackSegments), track)
+		segmentTranscript, err := p.transcribeSegment(dir, segment, language, model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transcribe segment %d: %w", i+1, err)
+		}
+		segments = append(segments, segmentTranscript...)
+	}
+	return segments, nil
+}
+
+// TranscribeSegment transcribes a segment cut from a recording in progress,
+// so that by the time recording stops most of the transcript is there.
+func (p *OpenAIProcessor) TranscribeSegment(dir string, segment liveSegment) {
+	if !p.config.CanTranscribe(p.config.GetModel()) {
+		return
 	}
+	if _, err := p.transcribeSegment(dir, segment, p.config.GetLanguage(), p.config.GetModel()); err != nil {
+		fmt.Printf("Warning: live transcription of %s failed, retrying after stop: %v\n", segment.File, err)
+	}
+}
 
-	req.Header.Set("Authorization", "Bearer "+p.config.GetOpenAIAPIKey())
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+// transcribeSegment returns the transcript of a live segment, positioned in
+// the track. It is checkpointed next to the segment and reused from there.
+func (p *OpenAIProcessor) transcribeSegment(dir string, segment liveSegment, language, model string) ([]transcriptSegment, error) {
+	checkpoint := filepath.Join(dir, segment.checkpointName())
+	if data, err := os.ReadFile(checkpoint); err == nil {
+		var segments []transcriptSegment
+		if err := json.Unmarshal(data, &segments); err == nil {
+			return segments, nil
+		}
+	}
 
-	client := &http.Client{Timeout: 5 * time.Minute}
-	resp, err := client.Do(req)
+	segments, err := p.transcribeRecording(filepath.Join(dir, segment.File), language, model, trackPrompt(segment.Track))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("DEBUG: OpenAI Transcription API Error - Status: %d, Headers: %v, Body: %s\n", resp.StatusCode, resp.Header, string(body))
-		return "", fmt.Errorf("OpenAI API error %d: %s", resp.StatusCode, string(body))
+	for i := range segments {
+		segments[i].Start += segment.Start
+		segments[i].End += segment.Start
 	}
 
-	var transcription openAITranscriptionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&transcription); err != nil {
-		return "", err
+	if data, err := json.Marshal(segments); err == nil {
+		if err := os.WriteFile(checkpoint, data, 0644); err != nil {
+			fmt.Printf("Warning: failed to checkpoint %s: %v\n", segment.File, err)
+		}
 	}
+	return segments, nil
+}
 
-	return transcription.Text, nil
+// trackPrompt is the transcription prompt for a track. The model only has to
+// tell speakers apart when they all share one recording.
+func trackPrompt(track string) string {
+	if track == recordingTrackName {
+		return speakerLabelPrompt
+	}
+	return ""
 }
 
-func (p *OpenAIProcessor) splitAudioFile(audioFile string) ([]string, error) {
-	const chunkDurationMinutes = 3
-	
-	tempDir := filepath.Join(os.TempDir(), "audio_chunks")
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+// transcribeTracks transcribes the microphone and system audio separately and
+// interleaves the two by time, so speakers are told apart by the track they
+// were recorded on rather than guessed by the model. Models without segment
+// timestamps can only be interleaved at chunk granularity.
+func (p *OpenAIProcessor) transcribeTracks(workDir, micTrack, systemTrack, language, model string) ([]transcriptSegment, error) {
+	micSegments, err := p.transcribeTrack(workDir, micTrackName, micTrack, language, model)
+	if err != nil {
+		return nil, fmt.Errorf("microphone track: %w", err)
 	}
-	
-	// open and decode the WAV file
-	file, err := os.Open(audioFile)
+
+	systemSegments, err := p.transcribeTrack(workDir, systemTrackName, systemTrack, language, model)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open audio file: %w", err)
+		return nil, fmt.Errorf("system audio track: %w", err)
 	}
-	defer file.Close()
-	
-	decoder := wav.NewDecoder(file)
-	if !decoder.IsValidFile() {
-		return nil, fmt.Errorf("invalid WAV file")
+
+	for i := range micSegments {
+		micSegments[i].Speaker = "Me"
 	}
-	
-	// read audio format info
-	decoder.FwdToPCM()
-	format := decoder.Format()
-	if format == nil {
-		return nil, fmt.Errorf("failed to read audio format")
+	for i := range systemSegments {
+		systemSegments[i].Speaker = "Them"
 	}
-	
-	sampleRate := int(format.SampleRate)
-	channels := int(format.NumChannels)
-	samplesPerChunk := sampleRate * channels * chunkDurationMinutes * 60
-	
-	baseFileName := strings.TrimSuffix(filepath.Base(audioFile), filepath.Ext(audioFile))
-	var chunks []string
-	chunkIndex := 0
-	
-	for {
-		// read chunk of samples
-		intBuf := &audio.IntBuffer{
-			Data:           make([]int, samplesPerChunk),
-			Format:         format,
-			SourceBitDepth: 16,
-		}
-		
-		n, err := decoder.PCMBuffer(intBuf)
-		if err != nil || n == 0 {
-			break
+
+	segments := append(micSegments, systemSegments...)
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].Start < segments[j].Start
+	})
+
+	return segments, nil
+}
+
+// segmentsText joins segments into transcript text. Segments attributed to a
+// speaker become dialogue lines with consecutive lines of a speaker merged.
+func segmentsText(segments []transcriptSegment) string {
+	var lines []string
+	lastSpeaker := ""
+	for _, segment := range segments {
+		text := strings.TrimSpace(segment.Text)
+		if text == "" {
+			continue
 		}
-		
-		// trim buffer to actual samples read
-		intBuf.Data = intBuf.Data[:n]
-		
-		// create output file for this chunk
-		outputFile := filepath.Join(tempDir, fmt.Sprintf("%s_chunk_%d.wav", baseFileName, chunkIndex))
-		outFile, err := os.Create(outputFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create chunk file: %w", err)
+
+		if len(lines) > 0 && segment.Speaker == lastSpeaker {
+			lines[len(lines)-1] += " " + text
+			continue
 		}
-		
-		// encode chunk as WAV
-		encoder := wav.NewEncoder(outFile, sampleRate, 16, channels, 1)
-		if err := encoder.Write(intBuf); err != nil {
-			outFile.Close()
-			return nil, fmt.Errorf("failed to write chunk: %w", err)
+		if segment.Speaker != "" {
+			text = segment.Speaker + ": " + text
 		}
-		
-		encoder.Close()
-		outFile.Close()
-		
-		chunks = append(chunks, outputFile)
-		chunkIndex++
-	}
-	
-	if len(chunks) == 0 {
-		return nil, fmt.Errorf("no audio chunks created - file may be empty")
+		lines = append(lines, text)
+		lastSpeaker = segment.Speaker
 	}
-	
-	return chunks, nil
+
+	return strings.Join(lines, "\n")
 }
 
-func (p *OpenAIProcessor) generateSummary(transcript string) (summary, title string, err error) {
+// generateSummary summarizes transcript. markers lists the moments flagged
+// during recording and may be empty.
+func (p *OpenAIProcessor) generateSummary(transcript, markers string) (summary, title string, err error) {
 	// check if transcript is too long and chunk if necessary
 	const maxChunkSize = 8000
 	
 	if len(transcript) <= maxChunkSize {
-		return p.generateSummaryChunk(transcript)
+		return p.generateSummaryChunk(transcript, markers)
 	}
 	
 	// split transcript into chunks
@@ -256,7 +505,7 @@ func (p *OpenAIProcessor) generateSummary(transcript string) (summary, title str
 	var finalTitle string
 	
 	for i, chunk := range chunks {
-		chunkSummary, chunkTitle, err := p.generateSummaryChunk(chunk)
+		chunkSummary, chunkTitle, err := p.generateSummaryChunk(chunk, markers)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to process chunk %d: %w", i+1, err)
 		}
@@ -298,13 +547,21 @@ func (p *OpenAIProcessor) chunkTranscript(transcript string, maxSize int) []stri
 	return chunks
 }
 
-func (p *OpenAIProcessor) generateSummaryChunk(transcript string) (summary, title string, err error) {
+func (p *OpenAIProcessor) generateSummaryChunk(transcript, markers string) (summary, title string, err error) {
+	var markerSection string
+	if markers != "" {
+		markerSection = fmt.Sprintf(`
+Participants marked these moments as important during the meeting (timestamp, optional label and what was said around it). Give them extra weight in the key points where they fall within this transcription:
+%s
+`, markers)
+	}
+
 	prompt := fmt.Sprintf(`Analyze the following meeting transcription and extract:
 1. Main topic/idea of the meeting (for file naming)
 2. Key points and decisions
 
 IMPORTANT: Generate the summary in the SAME LANGUAGE as the transcription.
-
+%s
 Transcription:
 %s
 
@@ -312,29 +569,32 @@ Response should be in JSON format:
 {
   "title": "brief title of the main meeting topic",
   "summary": "detailed key points and decisions with line breaks (\\n) for better readability"
-}`, transcript)
+}`, markerSection, transcript)
 
 	requestBody := map[string]any{
-		"model": "gpt-4",
 		"messages": []map[string]string{
 			{"role": "user", "content": prompt},
 		},
 		"max_tokens": 6000,
 		"temperature": 0.3,
 	}
+	if model := p.config.GetChatModel(); model != "" {
+		requestBody["model"] = model
+	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return "", "", err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	endpoint, err := p.chatEndpoint()
+	if err != nil {
+		return "", "", err
+	}
+	req, err := endpoint.newRequest(context.Background(), "/chat/completions", "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", "", err
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.config.GetOpenAIAPIKey())
 
 	client := &http.Client{Timeout: 2 * time.Minute}
 	resp, err := client.Do(req)
@@ -345,7 +605,7 @@ Response should be in JSON format:
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", "", fmt.Errorf("OpenAI API error %d: %s", resp.StatusCode, string(body))
+		return "", "", fmt.Errorf("API error %d from %s: %s", resp.StatusCode, req.URL.Host, string(body))
 	}
 
 	var response map[string]any
@@ -408,6 +668,9 @@ func saveSummary(title, summary string, meetingDate time.Time, sessionDir string
 	summary = strings.ReplaceAll(summary, "\\n", "\n")
 	
 	content := fmt.Sprintf("Встреча: %s\nДата: %s\n\n%s", title, meetingDate.Format("2006-01-02 15:04:05"), summary)
+	if quality := qualitySection(sessionDir); quality != "" {
+		content += "\n\nКачество записи:\n" + quality
+	}
 
 	return filePath, os.WriteFile(filePath, []byte(content), 0644)
 }
\ No newline at end of file
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChunkFailureCancelsUploads(t *testing.T) {
+	const chunkCount = 4
+
+	// the first chunk fails once the others are all uploading, and those
+	// wait for the server to answer until they are cancelled
+	var started, cancelled atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if strings.Contains(header.Filename, "_chunk_0") {
+			for deadline := time.Now().Add(5 * time.Second); started.Load() < chunkCount-1 && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Millisecond)
+			}
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+
+		started.Add(1)
+		select {
+		case <-r.Context().Done():
+			cancelled.Add(1)
+		case <-time.After(30 * time.Second):
+			w.Write([]byte(`{"text": "too late"}`))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	var chunks []audioChunk
+	for i := 0; i < chunkCount; i++ {
+		path, _ := writeTestWAV(t, dir, captureFormatPresets[speechFormat], 0.1)
+		chunkPath := filepath.Join(dir, fmt.Sprintf("recording_chunk_%d.wav", i))
+		if err := moveFile(path, chunkPath); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, audioChunk{Path: chunkPath, Start: float64(i) * 10})
+	}
+
+	p := NewOpenAIProcessor(&Config{TranscriptionConcurrency: chunkCount})
+	transcriber := &openAITranscriber{endpoint: apiEndpoint{baseURL: server.URL}, model: "whisper-1"}
+
+	start := time.Now()
+	_, err := p.transcribeChunks(transcriber, filepath.Join(dir, "recording.wav"), chunks, "auto", "")
+	if err == nil || !strings.Contains(err.Error(), "chunk 1") || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("transcribeChunks: %v, want chunk 1's API error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("transcribeChunks took %s, waiting for uploads after the failure", elapsed)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); cancelled.Load() < chunkCount-1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d uploads under way were cancelled", cancelled.Load(), chunkCount-1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChunkCheckpointMatchesItsChunk(t *testing.T) {
+	var uploaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		uploaded = append(uploaded, header.Filename)
+		w.Write([]byte(`{"text": "fresh", "segments": [{"start": 5, "end": 7, "text": "fresh"}]}`))
+	}))
+	defer server.Close()
+
+	// this attempt cuts chunk 1 at another start and chunk 2 at another
+	// length than the previous one, so only chunk 0 still matches
+	dir := t.TempDir()
+	previous := []chunkCheckpoint{
+		{Start: 0, Length: 20},
+		{Start: 18, Length: 20},
+		{Start: 30, Length: 20},
+	}
+	current := []audioChunk{
+		{Start: 0, Length: 20},
+		{Start: 15, Length: 20},
+		{Start: 30, Length: 17},
+	}
+	var chunks []audioChunk
+	for i, saved := range previous {
+		path, _ := writeTestWAV(t, dir, captureFormatPresets[speechFormat], 0.1)
+		chunkPath := filepath.Join(dir, fmt.Sprintf("recording_chunk_%d.wav", i))
+		if err := moveFile(path, chunkPath); err != nil {
+			t.Fatal(err)
+		}
+		chunk := current[i]
+		chunk.Path = chunkPath
+		chunks = append(chunks, chunk)
+
+		saved.Segments = []transcriptSegment{{Start: saved.Start + 5, End: saved.Start + 7, Text: "saved"}}
+		data, err := json.Marshal(saved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("recording_chunk_%d.json", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewOpenAIProcessor(&Config{TranscriptionConcurrency: 1})
+	transcriber := &openAITranscriber{endpoint: apiEndpoint{baseURL: server.URL}, model: "whisper-1", segments: true}
+	segments, err := p.transcribeChunks(transcriber, filepath.Join(dir, "recording.wav"), chunks, "auto", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"recording_chunk_1.wav", "recording_chunk_2.wav"}; !slices.Equal(uploaded, want) {
+		t.Errorf("uploaded %v, want %v", uploaded, want)
+	}
+	want := []transcriptSegment{
+		{Start: 5, End: 7, Text: "saved"},
+		{Start: 20, End: 22, Text: "fresh"},
+		{Start: 35, End: 37, Text: "fresh"},
+	}
+	if !slices.Equal(segments, want) {
+		t.Errorf("segments = %v, want %v", segments, want)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaptureSource produces signed 16-bit little-endian PCM in the capture
+// format it was created with.
+type CaptureSource interface {
+	Name() string
+	// Devices lists the inputs this backend can record from.
+	Devices() ([]InputDevice, error)
+	// Start opens the PCM stream. Closing the stream releases the source.
+	Start() (io.ReadCloser, error)
+	// Stop ends the stream so that a pending Read returns.
+	Stop() error
+}
+
+// outputReporter is implemented by sources backed by an external tool. The
+// tool's diagnostics are passed to report line by line.
+type outputReporter interface {
+	ReportOutput(report func(line string))
+}
+
+// newCaptureSource resolves a capture_source setting: "auto", a tool name
+// ("sox", "rec", "parec", "ffmpeg"), "stdin", "file:<path>" or the URL of a
+// network stream. An empty device records from the backend's default input.
+func newCaptureSource(spec, device string, format wavFormat) (CaptureSource, error) {
+	switch {
+	case spec == "" || spec == "auto":
+		return detectCaptureSource(device, format)
+	case spec == "sox" || spec == "rec":
+		return newSoxSource(spec, device, format), nil
+	case spec == "parec":
+		return newParecSource(device, format), nil
+	case spec == "ffmpeg":
+		return newFFmpegSource(device, format)
+	case spec == "stdin":
+		return &stdinSource{}, nil
+	case strings.HasPrefix(spec, "file:"):
+		return &fileSource{path: strings.TrimPrefix(spec, "file:"), format: format}, nil
+	case isStreamURL(spec):
+		return newStreamSource(spec, format), nil
+	default:
+		return nil, fmt.Errorf("unknown capture source %q", spec)
+	}
+}
+
+// newLoopbackSource returns a source for the audio the system is playing.
+// PulseAudio and PipeWire expose it as the default sink's monitor; elsewhere
+// a virtual loopback device such as BlackHole has to be configured.
+func newLoopbackSource(spec, device string, format wavFormat) (CaptureSource, error) {
+	if isExternalCaptureSource(spec) {
+		return nil, fmt.Errorf("%s sources have no system audio", spec)
+	}
+	if device != "" {
+		return newCaptureSource(spec, device, format)
+	}
+
+	if runtime.GOOS == "linux" && isCommandAvailable("pactl") {
+		if isCommandAvailable("parec") {
+			return newParecSource("@DEFAULT_MONITOR@", format), nil
+		}
+		if isCommandAvailable("ffmpeg") {
+			return newFFmpegSource("@DEFAULT_MONITOR@", format)
+		}
+	}
+	return nil, fmt.Errorf("no loopback device configured, set loopback_device to a virtual device such as BlackHole")
+}
+
+// isExternalCaptureSource reports whether a capture_source setting reads from
+// somewhere other than a local recording tool.
+func isExternalCaptureSource(spec string) bool {
+	return spec == "stdin" || strings.HasPrefix(spec, "file:") || isStreamURL(spec)
+}
+
+func detectCaptureSource(device string, format wavFormat) (CaptureSource, error) {
+	// under PipeWire parec goes through pipewire-pulse, which picks the
+	// default input far more reliably than sox's ALSA backend
+	if runtime.GOOS == "linux" && isCommandAvailable("parec") {
+		return newParecSource(device, format), nil
+	}
+	if isCommandAvailable("sox") {
+		return newSoxSource("sox", device, format), nil
+	}
+	if isCommandAvailable("rec") {
+		return newSoxSource("rec", device, format), nil
+	}
+	if isCommandAvailable("ffmpeg") {
+		return newFFmpegSource(device, format)
+	}
+	return nil, fmt.Errorf("no capture tool found (sox, parec or ffmpeg required)")
+}
+
+// commandSource captures audio from the stdout of an external tool.
+type commandSource struct {
+	name    string
+	args    []string
+	env     []string
+	devices func() ([]InputDevice, error)
+	report  func(line string)
+	cmd     *exec.Cmd
+}
+
+func newSoxSource(tool, device string, format wavFormat) *commandSource {
+	args := []string{"-t", "raw", "-b", strconv.Itoa(format.BitsPerSample), "-e", "signed-integer", "-r", strconv.Itoa(format.SampleRate), "-c", strconv.Itoa(format.Channels), "-"}
+	if tool == "sox" {
+		args = append([]string{"-d"}, args...)
+	}
+
+	source := &commandSource{name: tool, args: args, devices: listSoxDevices}
+	if device != "" {
+		// both sox -d and rec pick their input from these variables
+		source.env = []string{"AUDIODRIVER=" + soxDriver(), "AUDIODEV=" + device}
+	}
+	return source
+}
+
+func newParecSource(device string, format wavFormat) *commandSource {
+	args := []string{"--format=s16le", "--rate=" + strconv.Itoa(format.SampleRate), "--channels=" + strconv.Itoa(format.Channels), "--raw"}
+	if device != "" {
+		args = append(args, "--device="+device)
+	}
+	return &commandSource{name: "parec", args: args, devices: listPulseSources}
+}
+
+func newFFmpegSource(device string, format wavFormat) (*commandSource, error) {
+	var input []string
+	var devices func() ([]InputDevice, error)
+	switch runtime.GOOS {
+	case "darwin":
+		if device == "" {
+			device = "0"
+		}
+		input = []string{"-f", "avfoundation", "-i", ":" + device}
+		devices = func() ([]InputDevice, error) { return listFFmpegDevices("avfoundation") }
+	case "linux":
+		if device == "" {
+			device = "default"
+		}
+		if isCommandAvailable("pactl") {
+			input = []string{"-f", "pulse", "-i", device}
+			devices = listPulseSources
+		} else {
+			input = []string{"-f", "alsa", "-i", device}
+			devices = listALSADevices
+		}
+	case "windows":
+		devices = func() ([]InputDevice, error) { return listFFmpegDevices("dshow") }
+		if device == "" {
+			// dshow has no default input, so take the first one it reports
+			available, err := devices()
+			if err != nil || len(available) == 0 {
+				return nil, fmt.Errorf("no DirectShow audio input found")
+			}
+			device = available[0].ID
+		}
+		input = []string{"-f", "dshow", "-i", "audio=" + device}
+	default:
+		return nil, fmt.Errorf("ffmpeg capture is not supported on %s", runtime.GOOS)
+	}
+
+	args := append([]string{"-hide_banner", "-loglevel", "error"}, input...)
+	args = append(args, "-ar", strconv.Itoa(format.SampleRate), "-ac", strconv.Itoa(format.Channels), "-f", "s16le", "-")
+	return &commandSource{name: "ffmpeg", args: args, devices: devices}, nil
+}
+
+func (s *commandSource) Name() string {
+	return s.name
+}
+
+func (s *commandSource) Devices() ([]InputDevice, error) {
+	return s.devices()
+}
+
+func (s *commandSource) ReportOutput(report func(line string)) {
+	s.report = report
+}
+
+func (s *commandSource) Start() (io.ReadCloser, error) {
+	cmd := exec.Command(s.name, s.args...)
+	if len(s.env) > 0 {
+		cmd.Env = append(os.Environ(), s.env...)
+	}
+	if s.report != nil {
+		cmd.Stderr = &lineWriter{report: s.report}
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", s.name, err)
+	}
+
+	s.cmd = cmd
+	return &commandStream{ReadCloser: stdout, name: s.name, cmd: cmd}, nil
+}
+
+func (s *commandSource) Stop() error {
+	if s.cmd == nil || s.cmd.Process == nil {
+		return nil
+	}
+	return s.cmd.Process.Kill()
+}
+
+type commandStream struct {
+	io.ReadCloser
+	name    string
+	cmd     *exec.Cmd
+	waited  bool
+	waitErr error
+}
+
+// Read turns the end of the tool's output into the reason it exited.
+func (s *commandStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	if err == io.EOF {
+		if waitErr := s.wait(); waitErr != nil {
+			return n, fmt.Errorf("%s exited: %w", s.name, waitErr)
+		}
+	}
+	return n, err
+}
+
+func (s *commandStream) Close() error {
+	s.ReadCloser.Close()
+	// the process is usually killed by Stop, so its exit status says nothing
+	s.wait()
+	return nil
+}
+
+func (s *commandStream) wait() error {
+	if !s.waited {
+		s.waited = true
+		s.waitErr = s.cmd.Wait()
+	}
+	return s.waitErr
+}
+
+// lineWriter passes every non-empty line written to it to report.
+type lineWriter struct {
+	report func(line string)
+	buffer []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		end := bytes.IndexAny(w.buffer, "\r\n")
+		if end < 0 {
+			return len(p), nil
+		}
+		if line := strings.TrimSpace(string(w.buffer[:end])); line != "" {
+			w.report(line)
+		}
+		w.buffer = w.buffer[end+1:]
+	}
+}
+
+// fileSource replays a WAV or raw PCM file at real-time speed, which lets the
+// whole recording path run without a microphone.
+type fileSource struct {
+	path   string
+	format wavFormat
+	file   *os.File
+}
+
+func (s *fileSource) Name() string {
+	return "file"
+}
+
+func (s *fileSource) Devices() ([]InputDevice, error) {
+	return nil, nil
+}
+
+func (s *fileSource) Start() (io.ReadCloser, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stream io.Reader = file
+	if strings.EqualFold(filepath.Ext(s.path), ".wav") {
+		format, dataSize, err := readWAVFormat(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+		}
+		if format != s.format {
+			file.Close()
+			return nil, fmt.Errorf("%s is %s, recorder expects %s", s.path, format, s.format)
+		}
+		stream = io.LimitReader(file, dataSize)
+	}
+
+	s.file = file
+	return &pacedReader{
+		reader:  stream,
+		closer:  file,
+		rate:    s.format.byteRate(),
+		started: time.Now(),
+	}, nil
+}
+
+func (s *fileSource) Stop() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// pacedReader delays reads so data arrives no faster than rate bytes/second.
+type pacedReader struct {
+	reader  io.Reader
+	closer  io.Closer
+	rate    int
+	started time.Time
+	read    int64
+}
+
+func (r *pacedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	due := r.started.Add(time.Duration(r.read) * time.Second / time.Duration(r.rate))
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+func (r *pacedReader) Close() error {
+	return r.closer.Close()
+}
+
+// stdinSource reads PCM in the capture format piped into the process, e.g.
+// `sox input.flac -t raw -b 16 -e signed-integer -r 44100 -c 1 - | storyshort`.
+type stdinSource struct {
+	pipe *io.PipeWriter
+}
+
+func (s *stdinSource) Name() string {
+	return "stdin"
+}
+
+func (s *stdinSource) Devices() ([]InputDevice, error) {
+	return nil, nil
+}
+
+func (s *stdinSource) Start() (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	s.pipe = writer
+	sharedStdin.attach(writer)
+	return reader, nil
+}
+
+func (s *stdinSource) Stop() error {
+	if s.pipe == nil {
+		return nil
+	}
+	sharedStdin.detach(s.pipe)
+	return s.pipe.CloseWithError(io.EOF)
+}
+
+// sharedStdin is the only reader of stdin in the process. A Read on stdin
+// cannot be interrupted, so a stopped recording cannot end its reader;
+// instead each recording attaches a pipe to this pump and detaches it on
+// Stop, and the next recording picks up where the last one left off.
+var sharedStdin = newStdinPump()
+
+type stdinPump struct {
+	mu       sync.Mutex
+	attached *sync.Cond
+	writer   *io.PipeWriter
+	started  bool
+	err      error
+}
+
+func newStdinPump() *stdinPump {
+	p := &stdinPump{}
+	p.attached = sync.NewCond(&p.mu)
+	return p
+}
+
+// attach makes writer the destination of everything read from stdin from
+// now on. Once stdin has ended, writer is closed with the error it ended on.
+func (p *stdinPump) attach(writer *io.PipeWriter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		writer.CloseWithError(p.err)
+		return
+	}
+	p.writer = writer
+	if !p.started {
+		p.started = true
+		go p.run(os.Stdin)
+	}
+	p.attached.Broadcast()
+}
+
+func (p *stdinPump) detach(writer *io.PipeWriter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.writer == writer {
+		p.writer = nil
+	}
+}
+
+// next waits until a recording is attached and returns its pipe.
+func (p *stdinPump) next() *io.PipeWriter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.writer == nil {
+		p.attached.Wait()
+	}
+	return p.writer
+}
+
+func (p *stdinPump) run(input io.Reader) {
+	buffer := make([]byte, 4096)
+	for {
+		// stdin is only read while a recording wants it
+		p.next()
+		n, err := input.Read(buffer)
+
+		// bytes a stopped recording did not take go to the next one
+		data := buffer[:n]
+		for len(data) > 0 {
+			writer := p.next()
+			written, werr := writer.Write(data)
+			data = data[written:]
+			if werr != nil {
+				p.detach(writer)
+			}
+		}
+
+		if err != nil {
+			p.mu.Lock()
+			p.err = err
+			if p.writer != nil {
+				p.writer.CloseWithError(err)
+				p.writer = nil
+			}
+			p.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// seconds consecutive chunks share, so a word cut at the end of one is
+	// whole in the next
+	chunkOverlap = 2.0
+	// chunks are planned to fill this share of the size limit, leaving room
+	// for stretches that compress worse than the recording's average
+	chunkSizeMargin = 0.8
+	// times the chunk length is shortened when a chunk still comes out larger
+	// than the limit
+	chunkSplitAttempts = 3
+	// chunks uploaded at once unless transcription_concurrency is set
+	defaultTranscriptionConcurrency = 4
+)
+
+// audioChunk is a piece of a recording cut for upload. Start is where it
+// begins in the recording and Length how long it was cut, in seconds.
+type audioChunk struct {
+	Path   string
+	Start  float64
+	Length float64
+}
+
+// splitAudioFile cuts audioFile by time into overlapping chunks no larger
+// than maxSize bytes, in the same container. The chunk length follows from
+// the file's average bitrate. WAV files and recordings compressed from a WAV
+// file that is still there are cut in-process, anything else with ffmpeg.
+func splitAudioFile(audioFile string, maxSize int64) ([]audioChunk, error) {
+	info, err := os.Stat(audioFile)
+	if err != nil {
+		return nil, err
+	}
+	source := audioFile
+	if wavPath := sourceWAV(audioFile); wavPath != "" {
+		source = wavPath
+	}
+	duration, err := audioDuration(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read duration of %s: %w", filepath.Base(audioFile), err)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("no audio chunks created - file may be empty")
+	}
+
+	chunkDir := filepath.Join(filepath.Dir(audioFile), "chunks")
+	if err := os.MkdirAll(chunkDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	bytesPerSecond := float64(info.Size()) / duration
+	length := math.Floor(chunkSizeMargin * float64(maxSize) / bytesPerSecond)
+	for attempt := 0; attempt < chunkSplitAttempts; attempt++ {
+		if length <= 2*chunkOverlap {
+			break
+		}
+		fmt.Printf("DEBUG: Splitting %s into %.0f s chunks\n", filepath.Base(audioFile), length)
+
+		chunks, err := cutChunks(audioFile, source, chunkDir, chunkStarts(duration, length), length)
+		if err != nil {
+			removeChunks(chunks)
+			return nil, err
+		}
+
+		var largest int64
+		for _, chunk := range chunks {
+			if info, err := os.Stat(chunk.Path); err == nil {
+				largest = max(largest, info.Size())
+			}
+		}
+		if largest <= maxSize {
+			return chunks, nil
+		}
+
+		removeChunks(chunks)
+		length = math.Floor(length * chunkSizeMargin * float64(maxSize) / float64(largest))
+	}
+	return nil, fmt.Errorf("could not split %s into chunks under %d bytes", filepath.Base(audioFile), maxSize)
+}
+
+// chunkStarts returns where chunks of length seconds begin so that together
+// they cover duration, each overlapping the previous one by chunkOverlap.
+func chunkStarts(duration, length float64) []float64 {
+	starts := []float64{0}
+	step := length - chunkOverlap
+	for start := step; start+chunkOverlap < duration; start += step {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// chunkBounds returns the part of the recording chunk i of chunks is
+// trusted for: overlaps are split down the middle between the two chunks.
+func chunkBounds(chunks []audioChunk, i int) (from, until float64) {
+	from, until = 0, math.Inf(1)
+	if i > 0 {
+		from = chunks[i].Start + chunkOverlap/2
+	}
+	if i+1 < len(chunks) {
+		until = chunks[i+1].Start + chunkOverlap/2
+	}
+	return from, until
+}
+
+// segmentsWithin keeps the segments centred in [from, until). A segment
+// without timestamps spans its whole chunk and is always kept.
+func segmentsWithin(segments []transcriptSegment, from, until float64) []transcriptSegment {
+	var kept []transcriptSegment
+	for _, segment := range segments {
+		middle := (segment.Start + segment.End) / 2
+		if segment.End <= segment.Start || (middle >= from && middle < until) {
+			kept = append(kept, segment)
+		}
+	}
+	return kept
+}
+
+// sourceWAV returns the WAV file audioFile was compressed from, when
+// compressAudio kept it, or "".
+func sourceWAV(audioFile string) string {
+	if !strings.HasSuffix(audioFile, compressedSuffix) {
+		return ""
+	}
+	wavPath := strings.TrimSuffix(audioFile, compressedSuffix) + ".wav"
+	if !fileExists(wavPath) {
+		return ""
+	}
+	return wavPath
+}
+
+// cutChunks writes the chunks of audioFile at starts. source is audioFile
+// itself or the WAV file it was compressed from.
+func cutChunks(audioFile, source, chunkDir string, starts []float64, length float64) ([]audioChunk, error) {
+	ext := filepath.Ext(audioFile)
+	base := strings.TrimSuffix(filepath.Base(audioFile), ext)
+
+	var chunks []audioChunk
+	for i, start := range starts {
+		chunk := audioChunk{
+			Path:   filepath.Join(chunkDir, fmt.Sprintf("%s_chunk_%d%s", base, i, ext)),
+			Start:  start,
+			Length: length,
+		}
+
+		var err error
+		switch {
+		case strings.EqualFold(ext, ".wav"):
+			err = cutWAV(audioFile, chunk.Path, start, length)
+		case source != audioFile:
+			err = cutAndCompress(source, chunk.Path, start, length)
+		default:
+			err = cutWithFFmpeg(audioFile, chunk.Path, start, length)
+		}
+		if err != nil {
+			return chunks, fmt.Errorf("failed to write chunk %d: %w", i+1, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+func removeChunks(chunks []audioChunk) {
+	for _, chunk := range chunks {
+		os.Remove(chunk.Path)
+	}
+}
+
+// audioDuration returns how long audioFile plays, in seconds.
+func audioDuration(audioFile string) (float64, error) {
+	if strings.EqualFold(filepath.Ext(audioFile), ".wav") {
+		file, err := os.Open(audioFile)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+
+		format, dataSize, err := wavData(file)
+		if err != nil {
+			return 0, err
+		}
+		return format.duration(dataSize).Seconds(), nil
+	}
+
+	if !isCommandAvailable("ffprobe") {
+		return 0, fmt.Errorf("splitting %s files requires ffmpeg", filepath.Ext(audioFile))
+	}
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", audioFile).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+// wavData reads the format of a WAV file and leaves it at the first sample,
+// returning the size of the audio that is actually there.
+func wavData(file *os.File) (wavFormat, int64, error) {
+	format, dataSize, err := readWAVFormat(file)
+	if err != nil {
+		return format, 0, err
+	}
+	if format.Channels < 1 || format.SampleRate < 1 || format.BitsPerSample < 8 {
+		return format, 0, fmt.Errorf("invalid WAV format: %s", format)
+	}
+
+	dataStart, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return format, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return format, 0, err
+	}
+	return format, min(dataSize, info.Size()-dataStart), nil
+}
+
+// cutWAV copies length seconds of a WAV file from start into a WAV file of
+// its own, sample-exact.
+func cutWAV(audioFile, chunkPath string, start, length float64) error {
+	file, err := os.Open(audioFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format, dataSize, err := wavData(file)
+	if err != nil {
+		return err
+	}
+	dataStart, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	offset := format.offset(start)
+	size := min(format.offset(length), dataSize-offset)
+	out, err := createWAV(chunkPath, format)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(file, dataStart+offset, size)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cutAndCompress cuts length seconds from start out of the WAV file a
+// recording was compressed from, and compresses them the way the recording
+// was, into chunkPath.
+func cutAndCompress(wavPath, chunkPath string, start, length float64) error {
+	cutPath := strings.TrimSuffix(chunkPath, filepath.Ext(chunkPath)) + ".wav"
+	defer os.Remove(cutPath)
+
+	if err := cutWAV(wavPath, cutPath, start, length); err != nil {
+		return err
+	}
+	if err := encodeSpeech(cutPath, chunkPath); err != nil {
+		os.Remove(chunkPath)
+		return err
+	}
+	return nil
+}
+
+// cutWithFFmpeg copies length seconds of any container from start without
+// re-encoding. Cuts fall on the nearest packet, a fraction of a second away
+// at most.
+func cutWithFFmpeg(audioFile, chunkPath string, start, length float64) error {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-nostdin", "-y",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64), "-t", strconv.FormatFloat(length, 'f', 3, 64),
+		"-i", audioFile, "-vn", "-c", "copy", "-map_metadata", "-1", chunkPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(chunkPath)
+		return fmt.Errorf("ffmpeg: %w\n%s", err, lastLines(string(out), 5))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeNoiseWAV writes seconds of noise, which compresses about as badly as
+// speech, as a 16 kHz mono WAV file named name in dir.
+func writeNoiseWAV(t *testing.T, dir, name string, seconds float64) string {
+	t.Helper()
+
+	format := captureFormatPresets[speechFormat]
+	path := filepath.Join(dir, name)
+	writer, err := createWAV(path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := uint32(1)
+	pcm := make([]byte, 0, format.offset(seconds))
+	for i := int64(0); i < format.offset(seconds)/2; i++ {
+		state ^= state << 13
+		state ^= state >> 17
+		state ^= state << 5
+		sample := int16(4000 * math.Sin(float64(i)/7) * float64(state%1000) / 1000)
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(sample))
+	}
+	writer.Write(pcm)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withoutFFmpeg leaves nothing but an empty directory on PATH.
+func withoutFFmpeg(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+}
+
+func checkChunks(t *testing.T, chunks []audioChunk, maxSize int64, magic string) {
+	t.Helper()
+
+	if len(chunks) < 2 {
+		t.Fatalf("split into %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		data, err := os.ReadFile(chunk.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(data)) > maxSize {
+			t.Errorf("chunk %d is %d bytes, over the %d limit", i, len(data), maxSize)
+		}
+		if !bytes.HasPrefix(data, []byte(magic)) {
+			t.Errorf("chunk %d is not %s", i, magic)
+		}
+		if i > 0 {
+			previous := chunks[i-1]
+			if end := previous.Start + chunkDuration(t, previous); chunk.Start > end-chunkOverlap+0.01 {
+				t.Errorf("chunk %d starts at %.2f s, not overlapping chunk %d ending at %.2f s", i, chunk.Start, i-1, end)
+			}
+		}
+	}
+}
+
+// chunkDuration returns how long a WAV or FLAC chunk plays, in seconds.
+func chunkDuration(t *testing.T, chunk audioChunk) float64 {
+	t.Helper()
+
+	if filepath.Ext(chunk.Path) == ".wav" {
+		duration, err := audioDuration(chunk.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return duration
+	}
+	// the STREAMINFO block after the marker and block header holds the
+	// sample count in its low 36 bits at offset 10
+	data, err := os.ReadFile(chunk.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := binary.BigEndian.Uint64(data[8+10:8+18]) & (1<<36 - 1)
+	return float64(samples) / uploadSampleRate
+}
+
+func TestSplitCompressedRecordingWithoutFFmpeg(t *testing.T) {
+	withoutFFmpeg(t)
+	dir := t.TempDir()
+	wavPath := writeNoiseWAV(t, dir, "recording.wav", 30)
+	flacPath := filepath.Join(dir, "recording"+compressedSuffix)
+	if err := encodeSpeech(wavPath, flacPath); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(flacPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := info.Size() / 3
+	chunks, err := splitAudioFile(flacPath, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeChunks(chunks)
+	checkChunks(t, chunks, maxSize, "fLaC")
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "chunks", "*.wav"))
+	if len(leftovers) > 0 {
+		t.Errorf("cut WAV files left behind: %v", leftovers)
+	}
+}
+
+func TestSplitWAVWithoutFFmpeg(t *testing.T) {
+	withoutFFmpeg(t)
+	wavPath := writeNoiseWAV(t, t.TempDir(), "recording.wav", 30)
+	info, err := os.Stat(wavPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maxSize := info.Size() / 3
+	chunks, err := splitAudioFile(wavPath, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeChunks(chunks)
+	checkChunks(t, chunks, maxSize, "RIFF")
+}
+
+func TestSplitFLACWithoutSourceNeedsFFmpeg(t *testing.T) {
+	withoutFFmpeg(t)
+	dir := t.TempDir()
+	wavPath := writeNoiseWAV(t, dir, "recording.wav", 10)
+	flacPath := filepath.Join(dir, "recording"+compressedSuffix)
+	if err := encodeSpeech(wavPath, flacPath); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(wavPath)
+
+	_, err := splitAudioFile(flacPath, 1024)
+	if err == nil || !strings.Contains(err.Error(), "requires ffmpeg") {
+		t.Errorf("splitting a FLAC file alone without ffmpeg: %v, want it to require ffmpeg", err)
+	}
+}
+
+func TestCompressRemovesSourceOfSmallRecording(t *testing.T) {
+	ar := NewAudioRecorder(&Config{CaptureFormat: speechFormat})
+	dir := t.TempDir()
+
+	small := writeNoiseWAV(t, dir, "small.wav", 1)
+	if _, err := ar.compressAudio(small); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(small) {
+		t.Error("original of a recording small enough to upload was kept")
+	}
+	if sourceWAV(filepath.Join(dir, "small"+compressedSuffix)) != "" {
+		t.Error("sourceWAV found a removed original")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// speech has nothing below this, only rumble, handling noise and hum
+	highPassCutoff = 80.0
+	// loudness recordings are normalized to, as EBU R128 recommends
+	loudnessTarget = -23.0
+	// normalization never raises the highest sample above this, in dBFS
+	loudnessPeakCeiling = -1.0
+)
+
+// cleanupStages are the processing steps applied to a recording before
+// upload, each toggled by its own setting.
+type cleanupStages struct {
+	highPass  bool
+	noiseGate bool
+	normalize bool
+}
+
+func cleanupStagesFor(config *Config) cleanupStages {
+	return cleanupStages{
+		highPass:  config.GetHighPassFilter(),
+		noiseGate: config.GetNoiseReduction(),
+		normalize: config.GetNormalizeLoudness(),
+	}
+}
+
+func (s cleanupStages) any() bool {
+	return s.highPass || s.noiseGate || s.normalize
+}
+
+// cleanFileBase is the name a recording's cleaned up version is stored under,
+// e.g. "track_mic_clean" for track_mic_compressed.flac.
+func cleanFileBase(audioFile string) string {
+	base := strings.TrimSuffix(filepath.Base(audioFile), filepath.Ext(audioFile))
+	return strings.TrimSuffix(base, "_compressed") + "_clean"
+}
+
+// findCleanVersion returns the cleaned up version of audioFile, or "" when
+// no cleanup stage was on for it.
+func findCleanVersion(audioFile string) string {
+	return findTrack(filepath.Dir(audioFile), cleanFileBase(audioFile))
+}
+
+// cleanAudio writes a copy of the 16-bit WAV file wavPath run through the
+// given stages next to it, named after cleanFileBase, and returns its path.
+// The copy has the same format and length, so timestamps in it hold for the
+// original too.
+func cleanAudio(wavPath string, stages cleanupStages) (string, error) {
+	in, err := os.Open(wavPath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	format, dataSize, err := readWAVFormat(in)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", wavPath, err)
+	}
+	if format.BitsPerSample != 16 {
+		return "", fmt.Errorf("audio cleanup needs 16-bit audio")
+	}
+	if format.Channels < 1 || format.SampleRate < 1 {
+		return "", fmt.Errorf("invalid WAV format: %d channels at %d Hz", format.Channels, format.SampleRate)
+	}
+
+	cleanPath := filepath.Join(filepath.Dir(wavPath), cleanFileBase(wavPath)+".wav")
+	out, err := createWAV(cleanPath, format)
+	if err != nil {
+		return "", err
+	}
+
+	meter, err := filterAudio(io.LimitReader(in, dataSize), out, format, stages)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err == nil && stages.normalize {
+		err = normalizeLoudness(cleanPath, meter)
+	}
+	if err != nil {
+		os.Remove(cleanPath)
+		return "", err
+	}
+
+	return cleanPath, nil
+}
+
+// filterAudio runs the high-pass filter and noise gate over r channel by
+// channel and writes the result to w, measuring its loudness on the way.
+func filterAudio(r io.Reader, w io.Writer, format wavFormat, stages cleanupStages) (*loudnessMeter, error) {
+	channels := format.Channels
+	highPass := make([]*biquad, channels)
+	gates := make([]*spectralGate, channels)
+	for ch := 0; ch < channels; ch++ {
+		if stages.highPass {
+			highPass[ch] = newHighPass(highPassCutoff, format.SampleRate)
+		}
+		if stages.noiseGate {
+			gates[ch] = newSpectralGate(format.SampleRate)
+		}
+	}
+	meter := newLoudnessMeter(format.SampleRate, channels)
+
+	frameSize := 2 * channels
+	buf := make([]byte, 4096*frameSize)
+	input := make([][]float64, channels)
+	output := make([][]float64, channels)
+	var encoded []byte
+	frame := make([]float64, channels)
+
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		n -= n % frameSize
+		final := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+		if readErr != nil && !final {
+			return nil, readErr
+		}
+
+		for ch := 0; ch < channels; ch++ {
+			input[ch] = input[ch][:0]
+			for i := 2 * ch; i < n; i += frameSize {
+				sample := float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / 32768
+				if highPass[ch] != nil {
+					sample = highPass[ch].process(sample)
+				}
+				input[ch] = append(input[ch], sample)
+			}
+
+			output[ch] = output[ch][:0]
+			if gates[ch] == nil {
+				output[ch] = append(output[ch], input[ch]...)
+				continue
+			}
+			output[ch] = gates[ch].process(output[ch], input[ch])
+			if final {
+				output[ch] = gates[ch].flush(output[ch])
+			}
+		}
+
+		// every channel has been through the same number of gate frames, so
+		// their outputs line up
+		encoded = encoded[:0]
+		for i := range output[0] {
+			for ch := 0; ch < channels; ch++ {
+				frame[ch] = output[ch][i]
+				encoded = binary.LittleEndian.AppendUint16(encoded, uint16(clampSample(frame[ch]*32768)))
+			}
+			meter.add(frame)
+		}
+		if _, err := w.Write(encoded); err != nil {
+			return nil, err
+		}
+
+		if final {
+			return meter, nil
+		}
+	}
+}
+
+// normalizeLoudness scales the samples of wavPath in place so its integrated
+// loudness, as measured by meter, reaches loudnessTarget, unless that would
+// push the highest sample past loudnessPeakCeiling.
+func normalizeLoudness(wavPath string, meter *loudnessMeter) error {
+	loudness := meter.integrated()
+	if math.IsInf(loudness, -1) || meter.peak == 0 {
+		// nothing but silence
+		return nil
+	}
+	gain := math.Pow(10, (loudnessTarget-loudness)/20)
+	gain = math.Min(gain, math.Pow(10, loudnessPeakCeiling/20)/meter.peak)
+
+	file, err := os.OpenFile(wavPath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 64*1024)
+	for offset := int64(wavHeaderSize); ; offset += int64(len(buf)) {
+		n, readErr := file.ReadAt(buf, offset)
+		n -= n % 2
+		for i := 0; i < n; i += 2 {
+			sample := float64(int16(binary.LittleEndian.Uint16(buf[i:])))
+			binary.LittleEndian.PutUint16(buf[i:], uint16(clampSample(sample*gain)))
+		}
+		if _, err := file.WriteAt(buf[:n], offset); err != nil {
+			return err
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFloatWAV writes interleaved full-scale samples to a 16-bit WAV file.
+func writeFloatWAV(t *testing.T, path string, format wavFormat, samples []float64) {
+	t.Helper()
+
+	writer, err := createWAV(path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pcm []byte
+	for _, sample := range samples {
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(clampSample(sample*32768)))
+	}
+	if _, err := writer.Write(pcm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// measureWAV returns the integrated loudness and the peak, in dBFS, of a
+// 16-bit WAV file.
+func measureWAV(t *testing.T, path string) (loudness, peak float64) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	format, dataSize, err := wavData(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm, err := io.ReadAll(io.LimitReader(file, dataSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meter := newLoudnessMeter(format.SampleRate, format.Channels)
+	frame := make([]float64, format.Channels)
+	for i := 0; i+2*format.Channels <= len(pcm); i += 2 * format.Channels {
+		for ch := range frame {
+			frame[ch] = float64(int16(binary.LittleEndian.Uint16(pcm[i+2*ch:]))) / 32768
+		}
+		meter.add(frame)
+	}
+	return meter.integrated(), 20 * math.Log10(meter.peak)
+}
+
+func TestNormalizeLoudness(t *testing.T) {
+	tests := []struct {
+		name   string
+		format wavFormat
+		level  float64
+		click  bool
+	}{
+		{name: "quiet", format: wavFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}, level: 0.01},
+		{name: "loud", format: wavFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}, level: 0.5},
+		{name: "stereo", format: wavFormat{SampleRate: 44100, Channels: 2, BitsPerSample: 16}, level: 0.02},
+		// a full-scale click leaves no headroom to raise the tone to the target
+		{name: "peak limited", format: wavFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}, level: 0.01, click: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := 5 * tt.format.SampleRate
+			samples := make([]float64, 0, frames*tt.format.Channels)
+			for i := 0; i < frames; i++ {
+				sample := tt.level * math.Sin(2*math.Pi*997*float64(i)/float64(tt.format.SampleRate))
+				if tt.click && i == frames/2 {
+					sample = 0.99
+				}
+				for range tt.format.Channels {
+					samples = append(samples, sample)
+				}
+			}
+			wavPath := filepath.Join(t.TempDir(), "recording.wav")
+			writeFloatWAV(t, wavPath, tt.format, samples)
+
+			cleanPath, err := cleanAudio(wavPath, cleanupStages{normalize: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			loudness, peak := measureWAV(t, cleanPath)
+
+			if peak > loudnessPeakCeiling+0.05 {
+				t.Errorf("peak %.2f dBFS, above the %.0f dBFS ceiling", peak, loudnessPeakCeiling)
+			}
+			if tt.click {
+				if peak < loudnessPeakCeiling-0.1 {
+					t.Errorf("peak %.2f dBFS, want the gain to stop at the %.0f dBFS ceiling", peak, loudnessPeakCeiling)
+				}
+				if loudness > loudnessTarget-1 {
+					t.Errorf("%.2f LUFS, want the click to hold the tone below %.0f LUFS", loudness, loudnessTarget)
+				}
+				return
+			}
+			if math.Abs(loudness-loudnessTarget) > 0.2 {
+				t.Errorf("%.2f LUFS, want %.0f ± 0.2", loudness, loudnessTarget)
+			}
+		})
+	}
+
+	t.Run("silence", func(t *testing.T) {
+		wavPath := filepath.Join(t.TempDir(), "recording.wav")
+		format := wavFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}
+		writeFloatWAV(t, wavPath, format, make([]float64, format.SampleRate))
+		cleanPath, err := cleanAudio(wavPath, cleanupStages{normalize: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loudness, _ := measureWAV(t, cleanPath); !math.IsInf(loudness, -1) {
+			t.Errorf("silence normalized to %.2f LUFS", loudness)
+		}
+	})
+}
@@ -7,10 +7,43 @@ import (
 )
 
 type Config struct {
-	OpenAIAPIKey string `json:"openai_api_key"`
-	SaveLocation string `json:"save_location"`
-	Language     string `json:"language"`
-	Model        string `json:"model"`
+	OpenAIAPIKey         string `json:"openai_api_key"`
+	SaveLocation         string `json:"save_location"`
+	Language             string `json:"language"`
+	Model                string `json:"model"`
+	CaptureSource        string `json:"capture_source"`
+	InputDevice          string `json:"input_device"`
+	CaptureSystemAudio   bool   `json:"capture_system_audio"`
+	LoopbackDevice       string `json:"loopback_device"`
+	TrimSilence          bool   `json:"trim_silence"`
+	HighPassFilter       bool   `json:"high_pass_filter"`
+	NoiseReduction       bool   `json:"noise_reduction"`
+	NormalizeLoudness    bool   `json:"normalize_loudness"`
+	MaxDurationMinutes   int    `json:"max_duration_minutes"`
+	SilenceStopMinutes   int    `json:"silence_stop_minutes"`
+	StopAt               string `json:"stop_at"`
+	RollingBufferMinutes int    `json:"rolling_buffer_minutes"`
+	CaptureFormat        string `json:"capture_format"`
+	SampleRate           int    `json:"sample_rate,omitempty"`
+	Channels             int    `json:"channels,omitempty"`
+	WhisperBinary        string `json:"whisper_binary,omitempty"`
+	WhisperModelPath     string `json:"whisper_model_path,omitempty"`
+	// OpenAI-compatible servers to use instead of OpenAI, with headers they
+	// need on top of the API key
+	TranscriptionBaseURL string            `json:"transcription_base_url,omitempty"`
+	TranscriptionHeaders map[string]string `json:"transcription_headers,omitempty"`
+	ChatBaseURL          string            `json:"chat_base_url,omitempty"`
+	ChatHeaders          map[string]string `json:"chat_headers,omitempty"`
+	ChatModel            string            `json:"chat_model,omitempty"`
+	// Provider is "azure" for Azure OpenAI, which serves models as
+	// deployments of a resource; anything else means the OpenAI API
+	Provider                     string `json:"provider,omitempty"`
+	AzureEndpoint                string `json:"azure_endpoint,omitempty"`
+	AzureAPIVersion              string `json:"azure_api_version,omitempty"`
+	AzureTranscriptionDeployment string `json:"azure_transcription_deployment,omitempty"`
+	AzureTranscriptionModel      string `json:"azure_transcription_model,omitempty"`
+	AzureChatDeployment          string `json:"azure_chat_deployment,omitempty"`
+	TranscriptionConcurrency     int    `json:"transcription_concurrency,omitempty"`
 }
 
 func getConfigPath() (string, error) {
@@ -36,7 +69,7 @@ func loadConfig() (*Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		homeDir, _ := os.UserHomeDir()
 		defaultLocation := filepath.Join(homeDir, "Downloads", "storyshort")
-		return &Config{SaveLocation: defaultLocation, Language: "auto", Model: "whisper-1"}, nil
+		return &Config{SaveLocation: defaultLocation, Language: "auto", Model: "whisper-1", CaptureSource: "auto", CaptureFormat: standardFormat}, nil
 	}
 	
 	data, err := os.ReadFile(configPath)
@@ -59,6 +92,12 @@ func loadConfig() (*Config, error) {
 	if config.Model == "" {
 		config.Model = "whisper-1"
 	}
+	if config.CaptureSource == "" {
+		config.CaptureSource = "auto"
+	}
+	if config.CaptureFormat == "" {
+		config.CaptureFormat = standardFormat
+	}
 	
 	return &config, nil
 }
@@ -81,6 +120,21 @@ func (c *Config) HasValidToken() bool {
 	return c.OpenAIAPIKey != "" && len(c.OpenAIAPIKey) > 10
 }
 
+// CanTranscribe reports whether recordings can be transcribed with model:
+// a local model runs without an API key, a cloud one needs it unless it is
+// served from a transcription_base_url of its own, such as LocalAI without
+// authentication.
+func (c *Config) CanTranscribe(model string) bool {
+	return isLocalModel(model) || c.HasValidToken() || (!c.UsesAzure() && c.TranscriptionBaseURL != "")
+}
+
+// CanSummarize reports whether transcripts can be sent to the chat endpoint,
+// which needs an API key unless chat_base_url is set. Without it a transcript
+// is saved without a summary.
+func (c *Config) CanSummarize() bool {
+	return c.HasValidToken() || (!c.UsesAzure() && c.ChatBaseURL != "")
+}
+
 func (c *Config) GetOpenAIAPIKey() string {
 	return c.OpenAIAPIKey
 }
@@ -113,6 +167,179 @@ func (c *Config) SetModel(model string) {
 	c.Model = model
 }
 
+func (c *Config) GetCaptureSource() string {
+	return c.CaptureSource
+}
+
+func (c *Config) SetCaptureSource(source string) {
+	c.CaptureSource = source
+}
+
+func (c *Config) GetInputDevice() string {
+	return c.InputDevice
+}
+
+func (c *Config) SetInputDevice(device string) {
+	c.InputDevice = device
+}
+
+func (c *Config) GetCaptureSystemAudio() bool {
+	return c.CaptureSystemAudio
+}
+
+func (c *Config) SetCaptureSystemAudio(enabled bool) {
+	c.CaptureSystemAudio = enabled
+}
+
+func (c *Config) GetLoopbackDevice() string {
+	return c.LoopbackDevice
+}
+
+func (c *Config) GetTrimSilence() bool {
+	return c.TrimSilence
+}
+
+func (c *Config) SetTrimSilence(enabled bool) {
+	c.TrimSilence = enabled
+}
+
+func (c *Config) GetHighPassFilter() bool {
+	return c.HighPassFilter
+}
+
+func (c *Config) SetHighPassFilter(enabled bool) {
+	c.HighPassFilter = enabled
+}
+
+func (c *Config) GetNoiseReduction() bool {
+	return c.NoiseReduction
+}
+
+func (c *Config) SetNoiseReduction(enabled bool) {
+	c.NoiseReduction = enabled
+}
+
+func (c *Config) GetNormalizeLoudness() bool {
+	return c.NormalizeLoudness
+}
+
+func (c *Config) SetNormalizeLoudness(enabled bool) {
+	c.NormalizeLoudness = enabled
+}
+
+func (c *Config) GetMaxDurationMinutes() int {
+	return c.MaxDurationMinutes
+}
+
+func (c *Config) SetMaxDurationMinutes(minutes int) {
+	c.MaxDurationMinutes = minutes
+}
+
+func (c *Config) GetSilenceStopMinutes() int {
+	return c.SilenceStopMinutes
+}
+
+func (c *Config) SetSilenceStopMinutes(minutes int) {
+	c.SilenceStopMinutes = minutes
+}
+
+func (c *Config) GetStopAt() string {
+	return c.StopAt
+}
+
+func (c *Config) SetStopAt(clock string) {
+	c.StopAt = clock
+}
+
+func (c *Config) GetRollingBufferMinutes() int {
+	return c.RollingBufferMinutes
+}
+
+func (c *Config) SetRollingBufferMinutes(minutes int) {
+	c.RollingBufferMinutes = minutes
+}
+
+func (c *Config) GetCaptureFormat() string {
+	return c.CaptureFormat
+}
+
+func (c *Config) SetCaptureFormat(format string) {
+	c.CaptureFormat = format
+}
+
 func (c *Config) Save() error {
 	return saveConfig(c)
-}
\ No newline at end of file
+}
+
+func (c *Config) GetWhisperBinary() string {
+	return c.WhisperBinary
+}
+
+// GetWhisperModelPath returns where local transcription models are kept,
+// ~/.shortstory/models unless set otherwise.
+func (c *Config) GetWhisperModelPath() string {
+	if c.WhisperModelPath != "" {
+		return c.WhisperModelPath
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".shortstory", "models")
+}
+
+func (c *Config) GetTranscriptionBaseURL() string {
+	if c.TranscriptionBaseURL != "" {
+		return c.TranscriptionBaseURL
+	}
+	return defaultAPIBaseURL
+}
+
+func (c *Config) GetChatBaseURL() string {
+	if c.ChatBaseURL != "" {
+		return c.ChatBaseURL
+	}
+	return defaultAPIBaseURL
+}
+
+// GetChatModel returns the model summaries are written with. Self-hosted
+// chat servers usually serve a different one than OpenAI's default. It is ""
+// for Azure, where the chat deployment decides.
+func (c *Config) GetChatModel() string {
+	if c.UsesAzure() {
+		return ""
+	}
+	if c.ChatModel != "" {
+		return c.ChatModel
+	}
+	return "gpt-4"
+}
+
+func (c *Config) UsesAzure() bool {
+	return c.Provider == "azure"
+}
+
+// GetAzureTranscriptionModel returns the model the Azure transcription
+// deployment runs, which decides the response format to ask for.
+func (c *Config) GetAzureTranscriptionModel() string {
+	if c.AzureTranscriptionModel != "" {
+		return c.AzureTranscriptionModel
+	}
+	return "whisper"
+}
+
+func (c *Config) GetAzureAPIVersion() string {
+	if c.AzureAPIVersion != "" {
+		return c.AzureAPIVersion
+	}
+	return defaultAzureAPIVersion
+}
+
+// GetTranscriptionConcurrency returns how many chunks of a long recording
+// are uploaded at once.
+func (c *Config) GetTranscriptionConcurrency() int {
+	if c.TranscriptionConcurrency > 0 {
+		return c.TranscriptionConcurrency
+	}
+	return defaultTranscriptionConcurrency
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestAPIKeyRequirements(t *testing.T) {
+	const key = "sk-0123456789abcdef"
+	tests := []struct {
+		name          string
+		config        Config
+		model         string
+		canTranscribe bool
+		canSummarize  bool
+	}{
+		{"cloud model with key", Config{OpenAIAPIKey: key}, "whisper-1", true, true},
+		{"cloud model without key", Config{}, "whisper-1", false, false},
+		{"local model without key", Config{}, localModelPrefix + "/models/ggml-base.bin", true, false},
+		{"local model with key", Config{OpenAIAPIKey: key}, localModelPrefix + "/models/ggml-base.bin", true, true},
+		{"custom servers without key", Config{TranscriptionBaseURL: "http://localhost:8080/v1", ChatBaseURL: "http://localhost:8000/v1"}, "whisper-1", true, true},
+		{"custom transcription server only", Config{TranscriptionBaseURL: "http://localhost:8080/v1"}, "whisper-1", true, false},
+		{"custom chat server only", Config{ChatBaseURL: "http://localhost:8000/v1"}, "whisper-1", false, true},
+		{"azure without key", Config{Provider: "azure", TranscriptionBaseURL: "http://localhost:8080/v1"}, "whisper-1", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.CanTranscribe(tt.model); got != tt.canTranscribe {
+				t.Errorf("CanTranscribe(%q) = %v, want %v", tt.model, got, tt.canTranscribe)
+			}
+			if got := tt.config.CanSummarize(); got != tt.canSummarize {
+				t.Errorf("CanSummarize() = %v, want %v", got, tt.canSummarize)
+			}
+		})
+	}
+}
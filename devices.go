@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+type InputDevice struct {
+	ID   string
+	Name string
+}
+
+// listPulseSources returns the PulseAudio (or pipewire-pulse) inputs, leaving
+// out the monitor sources that mirror the outputs.
+func listPulseSources() ([]InputDevice, error) {
+	out, err := exec.Command("pactl", "list", "sources").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pactl failed: %w", err)
+	}
+
+	var devices []InputDevice
+	var current InputDevice
+	flush := func() {
+		if current.ID != "" && !strings.HasSuffix(current.ID, ".monitor") {
+			if current.Name == "" {
+				current.Name = current.ID
+			}
+			devices = append(devices, current)
+		}
+		current = InputDevice{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Source #"):
+			flush()
+		case strings.HasPrefix(line, "Name:"):
+			current.ID = strings.TrimSpace(strings.TrimPrefix(line, "Name:"))
+		case strings.HasPrefix(line, "Description:"):
+			current.Name = strings.TrimSpace(strings.TrimPrefix(line, "Description:"))
+		}
+	}
+	flush()
+
+	return devices, nil
+}
+
+// listALSADevices parses `arecord -L`, where every device name starts a line
+// and its description follows indented.
+func listALSADevices() ([]InputDevice, error) {
+	out, err := exec.Command("arecord", "-L").Output()
+	if err != nil {
+		return nil, fmt.Errorf("arecord failed: %w", err)
+	}
+
+	var devices []InputDevice
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			if line == "null" || line == "default" {
+				continue
+			}
+			devices = append(devices, InputDevice{ID: line, Name: line})
+			continue
+		}
+
+		// only the first description line is kept
+		last := len(devices) - 1
+		if last >= 0 && devices[last].Name == devices[last].ID {
+			devices[last].Name = fmt.Sprintf("%s (%s)", strings.TrimSpace(line), devices[last].ID)
+		}
+	}
+
+	return devices, nil
+}
+
+var (
+	avfoundationDevice = regexp.MustCompile(`\[\d+\] (.+)$`)
+	dshowDevice        = regexp.MustCompile(`"([^"]+)"`)
+)
+
+// listFFmpegDevices parses the device list ffmpeg prints to stderr for the
+// avfoundation and dshow input formats.
+func listFFmpegDevices(format string) ([]InputDevice, error) {
+	if !isCommandAvailable("ffmpeg") {
+		return nil, fmt.Errorf("listing %s devices requires ffmpeg", format)
+	}
+
+	input := ""
+	if format == "dshow" {
+		input = "dummy"
+	}
+
+	// ffmpeg exits with an error after listing, so only its output matters
+	out, _ := exec.Command("ffmpeg", "-hide_banner", "-f", format, "-list_devices", "true", "-i", input).CombinedOutput()
+
+	var devices []InputDevice
+	inAudioSection := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch format {
+		case "avfoundation":
+			if strings.Contains(line, "audio devices:") {
+				inAudioSection = true
+				continue
+			}
+			if strings.Contains(line, "video devices:") {
+				inAudioSection = false
+				continue
+			}
+			if match := avfoundationDevice.FindStringSubmatch(line); inAudioSection && match != nil {
+				devices = append(devices, InputDevice{ID: match[1], Name: match[1]})
+			}
+		case "dshow":
+			// older builds group devices under a header, newer ones tag each line
+			if strings.Contains(line, "DirectShow audio devices") {
+				inAudioSection = true
+				continue
+			}
+			if strings.Contains(line, "DirectShow video devices") {
+				inAudioSection = false
+				continue
+			}
+			if strings.Contains(line, "Alternative name") {
+				continue
+			}
+			match := dshowDevice.FindStringSubmatch(line)
+			if match != nil && (inAudioSection || strings.HasSuffix(line, "(audio)")) {
+				devices = append(devices, InputDevice{ID: match[1], Name: match[1]})
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+func listSoxDevices() ([]InputDevice, error) {
+	switch runtime.GOOS {
+	case "linux":
+		return listALSADevices()
+	case "darwin":
+		// sox's coreaudio driver takes the same device names avfoundation reports
+		return listFFmpegDevices("avfoundation")
+	default:
+		return nil, fmt.Errorf("listing sox devices is not supported on %s", runtime.GOOS)
+	}
+}
+
+func soxDriver() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "coreaudio"
+	case "windows":
+		return "waveaudio"
+	default:
+		return "alsa"
+	}
+}
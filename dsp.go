@@ -0,0 +1,338 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// biquad is a second order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newHighPass returns a Butterworth high-pass at cutoff Hz, from the RBJ
+// audio EQ cookbook. It also takes out any DC offset.
+func newHighPass(cutoff float64, sampleRate int) *biquad {
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	q := math.Sqrt2 / 2
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return &biquad{
+		b0: (1 + cos) / 2 / a0,
+		b1: -(1 + cos) / a0,
+		b2: (1 + cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+const (
+	// bins whose smoothed level stays below noiseGateThreshold times the
+	// noise floor are taken as noise
+	noiseGateThreshold = 2.0
+	// and turned down to noiseGateFloor rather than muted, which keeps the
+	// room tone even and avoids warbling artifacts
+	noiseGateFloor = 0.25
+	// how fast the gate closes again after a bin carried sound, per frame
+	noiseGateRelease = 0.8
+	// how fast the noise floor estimate may rise, in dB per second
+	noiseFloorRiseDB = 3.0
+	// frames are about this long, rounded up to a power of two samples
+	noiseGateFrameSeconds = 0.032
+)
+
+// spectralGate attenuates the frequency bins of one channel that don't rise
+// above the noise floor. It works on overlapping FFT frames with a square
+// root Hann window on both sides, which add back up to the input where
+// nothing is gated. The noise floor of each bin follows the minimum of its
+// smoothed level, so it adapts when a fan speeds up or the room changes.
+type spectralGate struct {
+	size, hop int
+	window    []float64
+	input     []float64
+	output    []float64
+	pending   []float64
+	smooth    []float64
+	noise     []float64
+	gain      []float64
+	scratch   []float64
+	rise      float64
+	frame     []complex128
+	// output owed for the padding in front of the first frame, which is dropped
+	skip               int
+	consumed, produced int64
+}
+
+func newSpectralGate(sampleRate int) *spectralGate {
+	size := 1
+	for size < int(noiseGateFrameSeconds*float64(sampleRate)) {
+		size <<= 1
+	}
+	hop := size / 2
+
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size)))
+	}
+
+	bins := size/2 + 1
+	g := &spectralGate{
+		size:    size,
+		hop:     hop,
+		window:  window,
+		input:   make([]float64, size),
+		output:  make([]float64, size),
+		smooth:  make([]float64, bins),
+		noise:   make([]float64, bins),
+		gain:    make([]float64, bins),
+		scratch: make([]float64, bins),
+		rise:    math.Pow(10, noiseFloorRiseDB/20*float64(hop)/float64(sampleRate)),
+		frame:   make([]complex128, size),
+		skip:    size - hop,
+	}
+	for k := range g.gain {
+		g.gain[k] = 1
+	}
+	return g
+}
+
+// process appends to out the gated audio for samples. The output lags the
+// input by up to a frame; flush returns the rest.
+func (g *spectralGate) process(out, samples []float64) []float64 {
+	g.consumed += int64(len(samples))
+	g.pending = append(g.pending, samples...)
+	for len(g.pending) >= g.hop {
+		out = g.step(out, g.pending[:g.hop])
+		g.pending = g.pending[g.hop:]
+	}
+	return out
+}
+
+// flush appends the output process still owes, padding the input with
+// silence to push it through.
+func (g *spectralGate) flush(out []float64) []float64 {
+	total := g.consumed
+	for g.produced < total {
+		out = g.process(out, make([]float64, g.hop-len(g.pending)))
+	}
+	return out[:len(out)-int(g.produced-total)]
+}
+
+func (g *spectralGate) step(out, samples []float64) []float64 {
+	copy(g.input, g.input[g.hop:])
+	copy(g.input[g.size-g.hop:], samples)
+
+	for i, sample := range g.input {
+		g.frame[i] = complex(sample*g.window[i], 0)
+	}
+	fft(g.frame, false)
+
+	bins := len(g.gain)
+	gains := g.scratch
+	// the first frame is half padding, which would pass for a noise floor
+	padded := g.skip > 0
+	for k := 0; k < bins; k++ {
+		magnitude := cmplx.Abs(g.frame[k])
+		g.smooth[k] = 0.7*g.smooth[k] + 0.3*magnitude
+		switch {
+		case padded:
+		case g.noise[k] == 0:
+			g.smooth[k] = magnitude
+			g.noise[k] = magnitude
+		case g.smooth[k] < g.noise[k]:
+			g.noise[k] = g.smooth[k]
+		default:
+			g.noise[k] *= g.rise
+		}
+
+		gain := 1.0
+		if g.smooth[k] < noiseGateThreshold*g.noise[k] {
+			gain = noiseGateFloor
+		}
+		// open at once, close gradually so word tails aren't chopped
+		gains[k] = math.Max(gain, g.gain[k]*noiseGateRelease)
+	}
+	for k := 0; k < bins; k++ {
+		// smoothing across neighbouring bins avoids isolated tones
+		left, right := gains[max(k-1, 0)], gains[min(k+1, bins-1)]
+		g.gain[k] = 0.25*left + 0.5*gains[k] + 0.25*right
+	}
+
+	for k := 0; k < bins; k++ {
+		g.frame[k] *= complex(g.gain[k], 0)
+		if k > 0 && k < g.size-k {
+			g.frame[g.size-k] = cmplx.Conj(g.frame[k])
+		}
+	}
+	fft(g.frame, true)
+
+	for i := range g.output {
+		g.output[i] += real(g.frame[i]) * g.window[i]
+	}
+
+	emit := g.output[:g.hop]
+	if g.skip > 0 {
+		skipped := min(g.skip, g.hop)
+		g.skip -= skipped
+		emit = emit[skipped:]
+	}
+	out = append(out, emit...)
+	g.produced += int64(len(emit))
+
+	copy(g.output, g.output[g.hop:])
+	clear(g.output[g.size-g.hop:])
+	return out
+}
+
+// fft transforms x in place; its length must be a power of two. The inverse
+// is scaled by 1/n.
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for length := 2; length <= n; length <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(length))
+		for start := 0; start < n; start += length {
+			w := complex(1, 0)
+			for k := 0; k < length/2; k++ {
+				even, odd := x[start+k], x[start+k+length/2]*w
+				x[start+k] = even + odd
+				x[start+k+length/2] = even - odd
+				w *= step
+			}
+		}
+	}
+
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+const (
+	// loudness is measured over 400 ms blocks overlapping by 75%
+	loudnessBlockSeconds = 0.1
+	loudnessAbsoluteGate = -70.0
+	loudnessRelativeGate = -10.0
+)
+
+// loudnessMeter measures integrated loudness as EBU R128 (ITU-R BS.1770)
+// does: K-weighted, in gated 400 ms blocks.
+type loudnessMeter struct {
+	shelf, pass []*biquad
+	blockSize   int
+	samples     int
+	sum         float64
+	// mean square of every 100 ms quarter block
+	quarters []float64
+	peak     float64
+}
+
+func newLoudnessMeter(sampleRate, channels int) *loudnessMeter {
+	m := &loudnessMeter{blockSize: int(loudnessBlockSeconds * float64(sampleRate))}
+
+	// the K-weighting filters for any sample rate, as libebur128 derives them
+	fs := float64(sampleRate)
+	k := math.Tan(math.Pi * 1681.974450955533 / fs)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	k = math.Tan(math.Pi * 38.13547087602444 / fs)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	pass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	for ch := 0; ch < channels; ch++ {
+		s, p := shelf, pass
+		m.shelf = append(m.shelf, &s)
+		m.pass = append(m.pass, &p)
+	}
+	return m
+}
+
+// add measures one interleaved sample frame, in full-scale units.
+func (m *loudnessMeter) add(frame []float64) {
+	for ch, sample := range frame {
+		m.peak = math.Max(m.peak, math.Abs(sample))
+		weighted := m.pass[ch].process(m.shelf[ch].process(sample))
+		m.sum += weighted * weighted
+	}
+
+	m.samples++
+	if m.samples == m.blockSize {
+		m.quarters = append(m.quarters, m.sum/float64(m.blockSize))
+		m.samples, m.sum = 0, 0
+	}
+}
+
+// integrated returns the gated loudness in LUFS, or -Inf when everything
+// measured was below the absolute gate.
+func (m *loudnessMeter) integrated() float64 {
+	var blocks []float64
+	for i := 3; i < len(m.quarters); i++ {
+		power := (m.quarters[i-3] + m.quarters[i-2] + m.quarters[i-1] + m.quarters[i]) / 4
+		blocks = append(blocks, power)
+	}
+
+	gated := func(threshold float64) float64 {
+		var sum float64
+		count := 0
+		for _, power := range blocks {
+			if blockLoudness(power) > threshold {
+				sum += power
+				count++
+			}
+		}
+		if count == 0 {
+			return math.Inf(-1)
+		}
+		return blockLoudness(sum / float64(count))
+	}
+
+	absolute := gated(loudnessAbsoluteGate)
+	if math.IsInf(absolute, -1) {
+		return absolute
+	}
+	return gated(math.Max(absolute+loudnessRelativeGate, loudnessAbsoluteGate))
+}
+
+func blockLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func sine(frequency, amplitude float64, sampleRate int, seconds float64) []float64 {
+	samples := make([]float64, int(seconds*float64(sampleRate)))
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate))
+	}
+	return samples
+}
+
+func rms(samples []float64) float64 {
+	var sum float64
+	for _, sample := range samples {
+		sum += sample * sample
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestHighPass(t *testing.T) {
+	const sampleRate = 16000
+	tests := []struct {
+		frequency float64
+		// a second order Butterworth passes 1/sqrt(1 + (fc/f)^4)
+		minGain, maxGain float64
+	}{
+		{frequency: 20, minGain: 0.05, maxGain: 0.075},
+		{frequency: 40, minGain: 0.22, maxGain: 0.26},
+		{frequency: highPassCutoff, minGain: 0.69, maxGain: 0.72},
+		{frequency: 300, minGain: 0.99, maxGain: 1.01},
+		{frequency: 1000, minGain: 0.99, maxGain: 1.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%g Hz", tt.frequency), func(t *testing.T) {
+			filter := newHighPass(highPassCutoff, sampleRate)
+			input := sine(tt.frequency, 0.5, sampleRate, 2)
+			output := make([]float64, len(input))
+			for i, sample := range input {
+				output[i] = filter.process(sample)
+			}
+
+			// measured once the filter has settled
+			settled := sampleRate / 2
+			gain := rms(output[settled:]) / rms(input[settled:])
+			if gain < tt.minGain || gain > tt.maxGain {
+				t.Errorf("gain %.3f, want %.3f to %.3f", gain, tt.minGain, tt.maxGain)
+			}
+		})
+	}
+
+	t.Run("DC offset", func(t *testing.T) {
+		filter := newHighPass(highPassCutoff, sampleRate)
+		var last float64
+		for range sampleRate {
+			last = filter.process(0.25)
+		}
+		if math.Abs(last) > 1e-6 {
+			t.Errorf("a constant input settles at %g, want 0", last)
+		}
+	})
+}
+
+// runGate passes samples through a new spectral gate in uneven pieces, as
+// filterAudio hands them over.
+func runGate(sampleRate int, samples []float64) []float64 {
+	gate := newSpectralGate(sampleRate)
+	var output []float64
+	for rest := samples; len(rest) > 0; {
+		piece := min(len(rest), 4096)
+		output = gate.process(output, rest[:piece])
+		rest = rest[piece:]
+	}
+	return gate.flush(output)
+}
+
+func whiteNoise(level float64, n int) []float64 {
+	random := rand.New(rand.NewSource(1))
+	noise := make([]float64, n)
+	for i := range noise {
+		noise[i] = level * random.NormFloat64()
+	}
+	return noise
+}
+
+func TestSpectralGateOnNoise(t *testing.T) {
+	const sampleRate = 16000
+	noise := whiteNoise(0.02, 4*sampleRate+123)
+
+	output := runGate(sampleRate, noise)
+	if len(output) != len(noise) {
+		t.Fatalf("gate returned %d samples for %d", len(output), len(noise))
+	}
+	// past the first frames, which teach the gate the noise floor
+	settled := sampleRate / 4
+	reduction := rms(output[settled:]) / rms(noise[settled:])
+	if reduction > 0.6 {
+		t.Errorf("noise kept at %.2f of its level, want it turned down to at most 0.6", reduction)
+	}
+	if reduction < noiseGateFloor*0.9 {
+		t.Errorf("noise turned down to %.2f of its level, below the gate floor %.2f", reduction, noiseGateFloor)
+	}
+}
+
+func TestSpectralGateKeepsSpeech(t *testing.T) {
+	const sampleRate = 16000
+	noise := whiteNoise(0.02, 6*sampleRate)
+
+	// gliding tone bursts of 200 ms every 500 ms stand in for syllables
+	input := make([]float64, len(noise))
+	inBurst := func(i int) bool { return i*1000/sampleRate%500 < 200 }
+	for i := range input {
+		input[i] = noise[i]
+		if inBurst(i) {
+			frequency := 500 + float64(i%sampleRate)/16
+			input[i] += 0.05 * math.Sin(2*math.Pi*frequency*float64(i)/sampleRate)
+		}
+	}
+
+	output := runGate(sampleRate, input)
+	var bursts, burstsIn, gaps, gapsIn []float64
+	for i := sampleRate; i < len(output); i++ {
+		// clear of the edges, where the gate opens and closes
+		switch ms := i * 1000 / sampleRate % 500; {
+		case ms >= 20 && ms < 180:
+			bursts, burstsIn = append(bursts, output[i]), append(burstsIn, input[i])
+		case ms >= 250 && ms < 480:
+			gaps, gapsIn = append(gaps, output[i]), append(gapsIn, input[i])
+		}
+	}
+	if kept := rms(bursts) / rms(burstsIn); kept < 0.85 {
+		t.Errorf("bursts kept at %.2f of their level, want at least 0.85", kept)
+	}
+	if kept := rms(gaps) / rms(gapsIn); kept > 0.6 {
+		t.Errorf("noise between bursts kept at %.2f of its level, want at most 0.6", kept)
+	}
+}
+
+func TestLoudnessMeterSine(t *testing.T) {
+	// BS.1770 gives a full-scale 997 Hz sine on one channel -3.01 LUFS
+	for _, sampleRate := range []int{16000, 44100, 48000} {
+		meter := newLoudnessMeter(sampleRate, 1)
+		for _, sample := range sine(997, 1, sampleRate, 5) {
+			meter.add([]float64{sample})
+		}
+		if loudness := meter.integrated(); math.Abs(loudness+3.01) > 0.1 {
+			t.Errorf("%d Hz: %.2f LUFS, want -3.01", sampleRate, loudness)
+		}
+	}
+
+	silent := newLoudnessMeter(16000, 1)
+	for range 16000 * 2 {
+		silent.add([]float64{0})
+	}
+	if loudness := silent.integrated(); !math.IsInf(loudness, -1) {
+		t.Errorf("silence measures %.2f LUFS, want -Inf", loudness)
+	}
+}
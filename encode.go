@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// recordings are uploaded at the rate speech models work at
+	uploadSampleRate = 16000
+	// zero crossings of the resampling filter on each side of a sample
+	resampleZeros = 10
+	// suffix of the file a WAV recording is compressed into for upload
+	compressedSuffix = "_compressed.flac"
+)
+
+// encodeSpeech converts a 16-bit PCM WAV file of any rate and channel count
+// into 16 kHz mono FLAC at outPath. It runs in-process, so recordings are
+// compressed the same way whether or not ffmpeg or sox are installed.
+func encodeSpeech(wavPath, outPath string) error {
+	in, err := os.Open(wavPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	format, dataSize, err := readWAVFormat(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", wavPath, err)
+	}
+	if format.BitsPerSample != 16 {
+		return fmt.Errorf("unsupported WAV sample size %d bits, 16 required", format.BitsPerSample)
+	}
+	if format.Channels < 1 || format.SampleRate < 1 {
+		return fmt.Errorf("invalid WAV format: %d channels at %d Hz", format.Channels, format.SampleRate)
+	}
+
+	out, err := createFLAC(outPath, uploadSampleRate)
+	if err != nil {
+		return err
+	}
+
+	// audio captured with the speech preset is already at the upload rate
+	var resampler *resampler
+	if format.SampleRate != uploadSampleRate {
+		resampler = newResampler(format.SampleRate, uploadSampleRate)
+	}
+	frameSize := 2 * format.Channels
+	buf := make([]byte, 4096*frameSize)
+	mono := make([]float64, 0, 4096)
+	var resampled []int16
+
+	reader := io.LimitReader(in, dataSize)
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		n -= n % frameSize
+
+		mono = mono[:0]
+		for frame := 0; frame < n; frame += frameSize {
+			var sum float64
+			for ch := 0; ch < format.Channels; ch++ {
+				sum += float64(int16(binary.LittleEndian.Uint16(buf[frame+2*ch:])))
+			}
+			mono = append(mono, sum/float64(format.Channels))
+		}
+
+		final := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+		if readErr != nil && !final {
+			out.Close()
+			os.Remove(outPath)
+			return readErr
+		}
+
+		resampled = resampled[:0]
+		if resampler != nil {
+			resampled = resampler.resample(resampled, mono, final)
+		} else {
+			for _, sample := range mono {
+				resampled = append(resampled, clampSample(sample))
+			}
+		}
+		if err := out.Write(resampled); err != nil {
+			out.Close()
+			os.Remove(outPath)
+			return err
+		}
+		if final {
+			break
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(outPath)
+		return err
+	}
+	return nil
+}
+
+// resampler converts a stream of samples between two rates with a windowed
+// sinc filter that also cuts everything the lower rate can't carry. The
+// filter phases repeat with the ratio of the rates, so they are computed once.
+type resampler struct {
+	inRate  int64
+	outRate int64
+	// the input position of consecutive outputs advances in steps of
+	// inRate/outRate; phases are the fractional parts it takes, in units of
+	// outRate/phaseStep
+	phaseStep int64
+	half      int
+	filters   [][]float64
+	// history holds the input from absolute index base on that outputs still
+	// need, next is the index of the next output and consumed counts the input
+	history  []float64
+	base     int64
+	next     int64
+	consumed int64
+}
+
+func newResampler(inRate, outRate int) *resampler {
+	r := &resampler{inRate: int64(inRate), outRate: int64(outRate)}
+	r.phaseStep = gcd(r.inRate, r.outRate)
+
+	// cut a little below the lower Nyquist frequency, in cycles per input sample
+	cutoff := 0.475 * float64(min(inRate, outRate)) / float64(inRate)
+	r.half = int(math.Ceil(resampleZeros / (2 * cutoff)))
+
+	phases := r.outRate / r.phaseStep
+	r.filters = make([][]float64, phases)
+	for phase := range r.filters {
+		frac := float64(int64(phase)*r.phaseStep) / float64(r.outRate)
+		taps := make([]float64, 2*r.half)
+		for j := range taps {
+			// distance of the tap from the output position, in input samples
+			d := float64(j-r.half+1) - frac
+			taps[j] = 2 * cutoff * sinc(2*cutoff*d) * blackman(d, float64(r.half))
+		}
+		r.filters[phase] = taps
+	}
+
+	// the filter reaches half samples before the first one, which are silent
+	r.history = make([]float64, r.half)
+	r.base = -int64(r.half)
+	return r
+}
+
+// resample appends to out the output for input samples, passing final once
+// the stream has ended to drain what the filter still holds.
+func (r *resampler) resample(out []int16, samples []float64, final bool) []int16 {
+	r.history = append(r.history, samples...)
+	r.consumed += int64(len(samples))
+
+	total := (r.consumed*r.outRate + r.inRate - 1) / r.inRate
+	if final {
+		r.history = append(r.history, make([]float64, r.half)...)
+	}
+	available := r.base + int64(len(r.history))
+
+	for {
+		if final && r.next >= total {
+			break
+		}
+		pos := r.next * r.inRate
+		n := pos / r.outRate
+		if n+int64(r.half) >= available {
+			break
+		}
+
+		taps := r.filters[(pos%r.outRate)/r.phaseStep]
+		window := r.history[n-int64(r.half)+1-r.base:]
+		var sum float64
+		for j, tap := range taps {
+			sum += window[j] * tap
+		}
+		out = append(out, clampSample(sum))
+		r.next++
+	}
+
+	// drop what no later output reaches
+	first := r.next*r.inRate/r.outRate - int64(r.half) + 1
+	if drop := first - r.base; drop > 0 && drop <= int64(len(r.history)) {
+		r.history = append(r.history[:0], r.history[drop:]...)
+		r.base = first
+	}
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is the Blackman window over (-half, half).
+func blackman(x, half float64) float64 {
+	if math.Abs(x) >= half {
+		return 0
+	}
+	t := math.Pi * x / half
+	return 0.42 + 0.5*math.Cos(t) + 0.08*math.Cos(2*t)
+}
+
+func clampSample(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestEncodeSpeechKeepsSamples(t *testing.T) {
+	// at the upload rate nothing is resampled, so the channels' average comes
+	// back exactly
+	for _, channels := range []int{1, 2, 3} {
+		for _, frames := range []int{1, 7, 4095, 4097, 16001} {
+			t.Run(fmt.Sprintf("%d channels, %d frames", channels, frames), func(t *testing.T) {
+				format := wavFormat{SampleRate: uploadSampleRate, Channels: channels, BitsPerSample: 16}
+				want := testSignals(frames)["tone"]
+
+				// the channels spread evenly around the sample they average to
+				var pcm []byte
+				for _, sample := range want {
+					for ch := 0; ch < channels; ch++ {
+						value := sample + int16(2*ch-(channels-1))*100
+						pcm = binary.LittleEndian.AppendUint16(pcm, uint16(value))
+					}
+				}
+				// a frame cut short at the end is dropped
+				pcm = append(pcm, 0x12)
+
+				dir := t.TempDir()
+				wavPath := filepath.Join(dir, "recording.wav")
+				writer, err := createWAV(wavPath, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writer.Write(pcm)
+				if err := writer.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				flacPath := filepath.Join(dir, "recording"+compressedSuffix)
+				if err := encodeSpeech(wavPath, flacPath); err != nil {
+					t.Fatal(err)
+				}
+				rate, decoded := decodeFLAC(t, flacPath)
+				if rate != uploadSampleRate {
+					t.Errorf("sample rate %d, want %d", rate, uploadSampleRate)
+				}
+				if !slices.Equal(decoded, want) {
+					t.Errorf("decoded %d samples that differ from the %d encoded", len(decoded), len(want))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultAPIBaseURL      = "https://api.openai.com/v1"
+	defaultAzureAPIVersion = "2024-06-01"
+)
+
+// apiEndpoint is a server that speaks the OpenAI API: OpenAI itself, a
+// self-hosted one such as LocalAI, vLLM or a LiteLLM gateway, or an Azure
+// OpenAI deployment.
+type apiEndpoint struct {
+	baseURL string
+	apiKey  string
+	// azureAPIVersion is set for Azure, which takes it as the api-version
+	// query parameter and the key in an api-key header instead of Bearer auth
+	azureAPIVersion string
+	// headers are set on every request and may replace the key's header
+	headers map[string]string
+}
+
+func (p *OpenAIProcessor) transcriptionEndpoint() (apiEndpoint, error) {
+	if p.config.UsesAzure() {
+		return p.azureEndpoint(p.config.AzureTranscriptionDeployment, "azure_transcription_deployment", p.config.TranscriptionHeaders)
+	}
+	return apiEndpoint{
+		baseURL: p.config.GetTranscriptionBaseURL(),
+		apiKey:  p.config.GetOpenAIAPIKey(),
+		headers: p.config.TranscriptionHeaders,
+	}, nil
+}
+
+func (p *OpenAIProcessor) chatEndpoint() (apiEndpoint, error) {
+	if p.config.UsesAzure() {
+		return p.azureEndpoint(p.config.AzureChatDeployment, "azure_chat_deployment", p.config.ChatHeaders)
+	}
+	return apiEndpoint{
+		baseURL: p.config.GetChatBaseURL(),
+		apiKey:  p.config.GetOpenAIAPIKey(),
+		headers: p.config.ChatHeaders,
+	}, nil
+}
+
+// azureEndpoint returns the endpoint of a deployment on the configured Azure
+// OpenAI resource. setting names the deployment's config key for errors.
+func (p *OpenAIProcessor) azureEndpoint(deployment, setting string, headers map[string]string) (apiEndpoint, error) {
+	resource := strings.TrimSuffix(p.config.AzureEndpoint, "/")
+	if resource == "" {
+		return apiEndpoint{}, fmt.Errorf("azure_endpoint is not set")
+	}
+	if deployment == "" {
+		return apiEndpoint{}, fmt.Errorf("%s is not set", setting)
+	}
+	return apiEndpoint{
+		baseURL:         resource + "/openai/deployments/" + url.PathEscape(deployment),
+		apiKey:          p.config.GetOpenAIAPIKey(),
+		azureAPIVersion: p.config.GetAzureAPIVersion(),
+		headers:         headers,
+	}, nil
+}
+
+// newRequest returns a POST of body to path under the endpoint's base URL,
+// e.g. "/chat/completions", that is abandoned when ctx is cancelled.
+func (e apiEndpoint) newRequest(ctx context.Context, path, contentType string, body io.Reader) (*http.Request, error) {
+	base, err := url.Parse(e.baseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid API base URL %q", e.baseURL)
+	}
+
+	target := strings.TrimSuffix(e.baseURL, "/") + path
+	if e.azureAPIVersion != "" {
+		target += "?" + url.Values{"api-version": {e.azureAPIVersion}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if e.apiKey != "" {
+		if e.azureAPIVersion != "" {
+			req.Header.Set("api-key", e.apiKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+e.apiKey)
+		}
+	}
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// apiRequest is what a fake OpenAI-compatible server saw of a request.
+// Fields holds the form fields of a transcription and the JSON body of a
+// chat completion.
+type apiRequest struct {
+	Path   string
+	Query  string
+	Header http.Header
+	Fields map[string]any
+}
+
+// newFakeAPI serves transcriptions and chat completions under any base path
+// and returns the requests it has seen so far.
+func newFakeAPI(t *testing.T) (*httptest.Server, func() []apiRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []apiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields := map[string]any{}
+		if err := r.ParseMultipartForm(1 << 20); err == nil {
+			for name, values := range r.MultipartForm.Value {
+				fields[name] = values[0]
+			}
+		} else {
+			json.NewDecoder(r.Body).Decode(&fields)
+		}
+
+		mu.Lock()
+		requests = append(requests, apiRequest{Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header.Clone(), Fields: fields})
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/audio/transcriptions"):
+			json.NewEncoder(w).Encode(map[string]any{"text": "hello from the meeting"})
+		case strings.HasSuffix(r.URL.Path, "/chat/completions"):
+			content := `{"title": "Planning", "summary": "We planned."}`
+			json.NewEncoder(w).Encode(map[string]any{
+				"choices": []any{map[string]any{"message": map[string]any{"content": content}}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []apiRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]apiRequest(nil), requests...)
+	}
+}
+
+// callAPIs transcribes a short recording and summarizes its transcript with
+// config, as ProcessAudio would.
+func callAPIs(t *testing.T, config *Config) {
+	t.Helper()
+
+	audioFile, _ := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0.1)
+	p := NewOpenAIProcessor(config)
+	transcriber, err := p.transcriber("whisper-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, err := transcriber.Transcribe(context.Background(), audioFile, "auto", "")
+	if err != nil {
+		t.Fatalf("transcription: %v", err)
+	}
+	if segmentsText(segments) == "" {
+		t.Error("empty transcript")
+	}
+
+	summary, title, err := p.generateSummaryChunk(segmentsText(segments), "")
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if title != "Planning" || summary != "We planned." {
+		t.Errorf("summary %q titled %q, want the server's", summary, title)
+	}
+}
+
+func TestCustomServersWithoutKey(t *testing.T) {
+	server, requests := newFakeAPI(t)
+	config := &Config{
+		TranscriptionBaseURL: server.URL + "/stt/v1/",
+		ChatBaseURL:          server.URL + "/llm/v1",
+		ChatHeaders:          map[string]string{"X-Team": "research"},
+	}
+	if !config.CanTranscribe("whisper-1") || !config.CanSummarize() {
+		t.Fatal("custom servers need no API key")
+	}
+	callAPIs(t, config)
+
+	seen := requests()
+	if len(seen) != 2 {
+		t.Fatalf("server saw %d requests, want 2", len(seen))
+	}
+	for i, want := range []string{"/stt/v1/audio/transcriptions", "/llm/v1/chat/completions"} {
+		if seen[i].Path != want {
+			t.Errorf("request %d went to %s, want %s", i+1, seen[i].Path, want)
+		}
+		if auth := seen[i].Header.Get("Authorization"); auth != "" {
+			t.Errorf("request %d sent Authorization %q without a key", i+1, auth)
+		}
+	}
+	if team := seen[1].Header.Get("X-Team"); team != "research" {
+		t.Errorf("chat request X-Team = %q, want research", team)
+	}
+	if model := seen[0].Fields["model"]; model != "whisper-1" {
+		t.Errorf("transcription model = %v, want whisper-1", model)
+	}
+	if format := seen[0].Fields["response_format"]; format != "verbose_json" {
+		t.Errorf("transcription response_format = %v, want verbose_json for whisper-1", format)
+	}
+	if model := seen[1].Fields["model"]; model != "gpt-4" {
+		t.Errorf("chat model = %v, want the gpt-4 default", model)
+	}
+}
+
+func TestAzureDeployments(t *testing.T) {
+	const key = "azure-0123456789abcdef"
+	server, requests := newFakeAPI(t)
+	config := &Config{
+		OpenAIAPIKey:                 key,
+		Provider:                     "azure",
+		AzureEndpoint:                server.URL + "/",
+		AzureTranscriptionDeployment: "whisper",
+		AzureChatDeployment:          "gpt 4o",
+		AzureAPIVersion:              "2024-10-21",
+		// ignored in Azure mode
+		TranscriptionBaseURL: "http://localhost:1/v1",
+		ChatBaseURL:          "http://localhost:1/v1",
+	}
+	callAPIs(t, config)
+
+	seen := requests()
+	if len(seen) != 2 {
+		t.Fatalf("server saw %d requests, want 2", len(seen))
+	}
+	for i, want := range []string{
+		"/openai/deployments/whisper/audio/transcriptions",
+		"/openai/deployments/gpt 4o/chat/completions",
+	} {
+		request := seen[i]
+		if request.Path != want {
+			t.Errorf("request %d went to %s, want %s", i+1, request.Path, want)
+		}
+		if request.Query != "api-version=2024-10-21" {
+			t.Errorf("request %d query = %q, want api-version=2024-10-21", i+1, request.Query)
+		}
+		if got := request.Header.Get("api-key"); got != key {
+			t.Errorf("request %d api-key = %q, want the key", i+1, got)
+		}
+		if auth := request.Header.Get("Authorization"); auth != "" {
+			t.Errorf("request %d sent Authorization %q to Azure", i+1, auth)
+		}
+		// the deployment is the model
+		if model, ok := request.Fields["model"]; ok {
+			t.Errorf("request %d names model %v to a deployment", i+1, model)
+		}
+	}
+	if format := seen[0].Fields["response_format"]; format != "verbose_json" {
+		t.Errorf("transcription response_format = %v, want verbose_json from a Whisper deployment", format)
+	}
+}
+
+func TestAzureTranscriptionModel(t *testing.T) {
+	server, requests := newFakeAPI(t)
+	config := &Config{
+		OpenAIAPIKey:                 "azure-0123456789abcdef",
+		Provider:                     "azure",
+		AzureEndpoint:                server.URL,
+		AzureTranscriptionDeployment: "transcribe",
+		AzureTranscriptionModel:      "gpt-4o-transcribe",
+		AzureChatDeployment:          "gpt-4o",
+		ChatModel:                    "gpt-4o",
+	}
+	// the Model setting names an OpenAI model, which says nothing about the
+	// deployment
+	callAPIs(t, config)
+
+	seen := requests()
+	if len(seen) != 2 {
+		t.Fatalf("server saw %d requests, want 2", len(seen))
+	}
+	if format, ok := seen[0].Fields["response_format"]; ok {
+		t.Errorf("asked a gpt-4o-transcribe deployment for %v", format)
+	}
+	for i, request := range seen {
+		if model, ok := request.Fields["model"]; ok {
+			t.Errorf("request %d names model %v to a deployment", i+1, model)
+		}
+	}
+}
+
+func TestAzureDefaultsAndMissingSettings(t *testing.T) {
+	server, requests := newFakeAPI(t)
+	config := &Config{
+		OpenAIAPIKey:                 "azure-0123456789abcdef",
+		Provider:                     "azure",
+		AzureEndpoint:                server.URL,
+		AzureTranscriptionDeployment: "whisper",
+		AzureChatDeployment:          "gpt-4o",
+	}
+	callAPIs(t, config)
+	for i, request := range requests() {
+		if request.Query != "api-version="+defaultAzureAPIVersion {
+			t.Errorf("request %d query = %q, want the default api-version", i+1, request.Query)
+		}
+	}
+
+	p := NewOpenAIProcessor(&Config{Provider: "azure", AzureEndpoint: server.URL, AzureChatDeployment: "gpt-4o"})
+	if _, err := p.transcriptionEndpoint(); err == nil || !strings.Contains(err.Error(), "azure_transcription_deployment") {
+		t.Errorf("missing transcription deployment: %v", err)
+	}
+	p = NewOpenAIProcessor(&Config{Provider: "azure", AzureChatDeployment: "gpt-4o"})
+	if _, err := p.chatEndpoint(); err == nil || !strings.Contains(err.Error(), "azure_endpoint") {
+		t.Errorf("missing resource endpoint: %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"hash"
+	"os"
+)
+
+const (
+	flacBlockSize = 4096
+	// offset of the STREAMINFO body, after "fLaC" and the block header
+	flacStreamInfoOffset = 8
+	flacStreamInfoSize   = 34
+	// a rice parameter of 15 is the escape code
+	maxRiceParameter     = 14
+	maxPartitionOrder    = 8
+	maxFixedOrder        = 4
+	flacBitsPerSample    = 16
+	flacSubframeFixed    = 0x08
+	flacSubframeVerbatim = 0x01
+)
+
+// flacWriter streams 16-bit mono samples into a FLAC file. Like wavWriter it
+// writes the header up front and patches the totals it only knows at the end
+// on Close. Blocks are encoded with the fixed predictors and rice coded
+// residuals, which is most of what FLAC gains on speech.
+type flacWriter struct {
+	file       *os.File
+	out        *bufio.Writer
+	sampleRate int
+	block      []int32
+	frames     uint64
+	samples    uint64
+	minFrame   int
+	maxFrame   int
+	md5        hash.Hash
+	closed     bool
+}
+
+func createFLAC(path string, sampleRate int) (*flacWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &flacWriter{
+		file:       file,
+		out:        bufio.NewWriter(file),
+		sampleRate: sampleRate,
+		block:      make([]int32, 0, flacBlockSize),
+		md5:        md5.New(),
+	}
+
+	header := append([]byte("fLaC"), 0x80, 0, 0, flacStreamInfoSize)
+	header = append(header, w.streamInfo()...)
+	if _, err := w.out.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *flacWriter) Write(samples []int16) error {
+	var buf [2]byte
+	for _, sample := range samples {
+		binary.LittleEndian.PutUint16(buf[:], uint16(sample))
+		w.md5.Write(buf[:])
+
+		w.block = append(w.block, int32(sample))
+		if len(w.block) == flacBlockSize {
+			if err := w.writeFrame(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *flacWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if len(w.block) > 0 {
+		if err := w.writeFrame(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+	if err := w.out.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if _, err := w.file.WriteAt(w.streamInfo(), flacStreamInfoOffset); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *flacWriter) streamInfo() []byte {
+	var bits bitWriter
+	bits.write(flacBlockSize, 16)
+	bits.write(flacBlockSize, 16)
+	bits.write(uint64(w.minFrame), 24)
+	bits.write(uint64(w.maxFrame), 24)
+	bits.write(uint64(w.sampleRate), 20)
+	bits.write(0, 3) // one channel
+	bits.write(flacBitsPerSample-1, 5)
+	bits.write(w.samples>>32, 4)
+	bits.write(w.samples&0xFFFFFFFF, 32)
+	return append(bits.buf, w.md5.Sum(nil)...)
+}
+
+func (w *flacWriter) writeFrame() error {
+	var bits bitWriter
+	bits.write(0xFFF8, 16) // sync code, fixed block size
+	bits.write(7, 4)       // block size in a 16-bit field after the number
+	bits.write(0, 4)       // sample rate from STREAMINFO
+	bits.write(0, 4)       // mono
+	bits.write(4, 3)       // 16 bits per sample
+	bits.write(0, 1)
+	bits.buf = append(bits.buf, utf8Number(w.frames)...)
+	bits.write(uint64(len(w.block)-1), 16)
+	bits.buf = append(bits.buf, crc8(bits.buf))
+
+	encodeSubframe(&bits, w.block)
+
+	bits.align()
+	crc := crc16(bits.buf)
+	bits.buf = append(bits.buf, byte(crc>>8), byte(crc))
+
+	if _, err := w.out.Write(bits.buf); err != nil {
+		return err
+	}
+
+	if w.minFrame == 0 || len(bits.buf) < w.minFrame {
+		w.minFrame = len(bits.buf)
+	}
+	if len(bits.buf) > w.maxFrame {
+		w.maxFrame = len(bits.buf)
+	}
+	w.frames++
+	w.samples += uint64(len(w.block))
+	w.block = w.block[:0]
+	return nil
+}
+
+// encodeSubframe writes block with the fixed predictor that leaves the
+// smallest residual, or verbatim when prediction doesn't pay off.
+func encodeSubframe(bits *bitWriter, block []int32) {
+	order, residual := bestFixedPredictor(block)
+	partitionOrder, parameters, cost := bestPartitioning(residual, len(block), order)
+
+	if cost+order*flacBitsPerSample >= len(block)*flacBitsPerSample {
+		bits.write(0, 1)
+		bits.write(flacSubframeVerbatim, 6)
+		bits.write(0, 1)
+		for _, sample := range block {
+			bits.write(uint64(uint16(sample)), flacBitsPerSample)
+		}
+		return
+	}
+
+	bits.write(0, 1)
+	bits.write(uint64(flacSubframeFixed|order), 6)
+	bits.write(0, 1)
+	for _, sample := range block[:order] {
+		bits.write(uint64(uint16(sample)), flacBitsPerSample)
+	}
+
+	bits.write(0, 2) // 4-bit rice parameters
+	bits.write(uint64(partitionOrder), 4)
+	partitionSize := len(block) >> partitionOrder
+	start := 0
+	for i, k := range parameters {
+		// the first partition is short by the warm-up samples
+		end := (i+1)*partitionSize - order
+		bits.write(uint64(k), 4)
+		for _, r := range residual[start:end] {
+			u := foldResidual(r)
+			bits.unary(u >> k)
+			bits.write(u, uint(k))
+		}
+		start = end
+	}
+}
+
+// bestFixedPredictor returns the order of the fixed polynomial predictor with
+// the smallest absolute residual over block, and that residual.
+func bestFixedPredictor(block []int32) (int, []int32) {
+	var sums [maxFixedOrder + 1]uint64
+	for i := maxFixedOrder; i < len(block); i++ {
+		for order := 0; order <= maxFixedOrder; order++ {
+			sums[order] += uint64(abs64(fixedResidual(block, i, order)))
+		}
+	}
+
+	order := 0
+	if len(block) > maxFixedOrder {
+		for o := 1; o <= maxFixedOrder; o++ {
+			if sums[o] < sums[order] {
+				order = o
+			}
+		}
+	}
+
+	residual := make([]int32, 0, len(block))
+	for i := order; i < len(block); i++ {
+		residual = append(residual, int32(fixedResidual(block, i, order)))
+	}
+	return order, residual
+}
+
+func fixedResidual(x []int32, i, order int) int64 {
+	switch order {
+	case 1:
+		return int64(x[i]) - int64(x[i-1])
+	case 2:
+		return int64(x[i]) - 2*int64(x[i-1]) + int64(x[i-2])
+	case 3:
+		return int64(x[i]) - 3*int64(x[i-1]) + 3*int64(x[i-2]) - int64(x[i-3])
+	case 4:
+		return int64(x[i]) - 4*int64(x[i-1]) + 6*int64(x[i-2]) - 4*int64(x[i-3]) + int64(x[i-4])
+	}
+	return int64(x[i])
+}
+
+// bestPartitioning splits the residual of a block into the number of rice
+// partitions that codes it in the fewest bits. It returns the partition
+// order, the parameter of each partition and the estimated size in bits.
+func bestPartitioning(residual []int32, blockSize, order int) (int, []int, int) {
+	bestOrder, bestCost := 0, -1
+	var bestParameters []int
+
+	for partitionOrder := 0; partitionOrder <= maxPartitionOrder; partitionOrder++ {
+		partitions := 1 << partitionOrder
+		partitionSize := blockSize >> partitionOrder
+		if blockSize%partitions != 0 || partitionSize <= order {
+			break
+		}
+
+		cost := 0
+		parameters := make([]int, partitions)
+		start := 0
+		for i := range parameters {
+			end := (i+1)*partitionSize - order
+			var sum uint64
+			for _, r := range residual[start:end] {
+				sum += foldResidual(r)
+			}
+			k := riceParameter(sum, end-start)
+			parameters[i] = k
+			cost += 4 + (end-start)*(k+1) + int(sum>>k)
+			start = end
+		}
+
+		if bestCost < 0 || cost < bestCost {
+			bestOrder, bestCost, bestParameters = partitionOrder, cost, parameters
+		}
+	}
+
+	return bestOrder, bestParameters, bestCost
+}
+
+// riceParameter picks the parameter for n folded residuals summing to sum,
+// the one whose 2^k is closest to their mean.
+func riceParameter(sum uint64, n int) int {
+	k := 0
+	for k < maxRiceParameter && uint64(n)<<(k+1) < sum {
+		k++
+	}
+	return k
+}
+
+// foldResidual maps signed residuals onto unsigned ones, 0 -1 1 -2 ... to
+// 0 1 2 3 ..., as rice coding needs.
+func foldResidual(r int32) uint64 {
+	return uint64(uint32(r<<1) ^ uint32(r>>31))
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// utf8Number codes a frame number the way FLAC frame headers carry it, in
+// the UTF-8 scheme extended to 36 bits.
+func utf8Number(v uint64) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+
+	n := 2
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	b := make([]byte, n)
+	for i := n - 1; i > 0; i-- {
+		b[i] = 0x80 | byte(v&0x3F)
+		v >>= 6
+	}
+	b[0] = byte(0xFF<<(8-n)) | byte(v)
+	return b
+}
+
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// bitWriter packs values most significant bit first, as FLAC stores them.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write appends the low n bits of v, n at most 32.
+func (b *bitWriter) write(v uint64, n uint) {
+	b.acc = b.acc<<n | v&(1<<n-1)
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.nbits -= 8
+		b.buf = append(b.buf, byte(b.acc>>b.nbits))
+	}
+}
+
+// unary appends q zero bits and a terminating one.
+func (b *bitWriter) unary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		b.write(0, 32)
+	}
+	b.write(1, uint(q)+1)
+}
+
+func (b *bitWriter) align() {
+	if b.nbits > 0 {
+		b.write(0, 8-b.nbits)
+	}
+}
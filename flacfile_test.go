@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// bitReader reads values most significant bit first, as FLAC stores them.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (r *bitReader) read(t *testing.T, n uint) uint64 {
+	t.Helper()
+
+	var v uint64
+	for ; n > 0; n-- {
+		if r.pos >= 8*len(r.data) {
+			t.Fatal("FLAC data ends in the middle of a frame")
+		}
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) signed(t *testing.T, n uint) int32 {
+	t.Helper()
+	return int32(int64(r.read(t, n)<<(64-n)) >> (64 - n))
+}
+
+func (r *bitReader) unary(t *testing.T) uint64 {
+	t.Helper()
+	var q uint64
+	for r.read(t, 1) == 0 {
+		q++
+	}
+	return q
+}
+
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// decodeFLAC decodes the subset of FLAC flacWriter produces: one 16-bit
+// channel in verbatim and fixed predictor subframes. It checks every CRC and
+// the totals and MD5 in STREAMINFO on the way.
+func decodeFLAC(t *testing.T, path string) (sampleRate int, samples []int16) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("fLaC")) || data[4] != 0x80 || int(data[7]) != flacStreamInfoSize {
+		t.Fatalf("%s does not start with a lone STREAMINFO block", path)
+	}
+
+	info := &bitReader{data: data[flacStreamInfoOffset : flacStreamInfoOffset+flacStreamInfoSize]}
+	info.read(t, 16+16+24+24) // block and frame sizes
+	sampleRate = int(info.read(t, 20))
+	if channels := info.read(t, 3) + 1; channels != 1 {
+		t.Fatalf("STREAMINFO has %d channels, want 1", channels)
+	}
+	if bits := info.read(t, 5) + 1; bits != flacBitsPerSample {
+		t.Fatalf("STREAMINFO has %d bits per sample, want %d", bits, flacBitsPerSample)
+	}
+	total := info.read(t, 36)
+	sum := info.data[info.pos/8:]
+
+	r := &bitReader{data: data[flacStreamInfoOffset+flacStreamInfoSize:]}
+	for frame := uint64(0); r.pos < 8*len(r.data); frame++ {
+		start := r.pos / 8
+		if sync := r.read(t, 16); sync != 0xFFF8 {
+			t.Fatalf("frame %d: sync code %#x", frame, sync)
+		}
+		r.read(t, 4+4+4+3+1) // block size code, rate, channels, sample size
+		number := r.read(t, 8)
+		if number >= 0x80 {
+			n := 0
+			for number&(0x80>>n) != 0 {
+				n++
+			}
+			number &= 0xFF >> (n + 1)
+			for i := 1; i < n; i++ {
+				number = number<<6 | r.read(t, 8)&0x3F
+			}
+		}
+		if number != frame {
+			t.Fatalf("frame %d numbered %d", frame, number)
+		}
+		blockSize := int(r.read(t, 16)) + 1
+		if crc := byte(r.read(t, 8)); crc != crc8(r.data[start:r.pos/8-1]) {
+			t.Fatalf("frame %d: header CRC mismatch", frame)
+		}
+
+		samples = append(samples, decodeSubframe(t, r, blockSize)...)
+
+		r.align()
+		end := r.pos / 8
+		if crc := uint16(r.read(t, 16)); crc != crc16(r.data[start:end]) {
+			t.Fatalf("frame %d: CRC mismatch", frame)
+		}
+	}
+
+	if total != uint64(len(samples)) {
+		t.Errorf("STREAMINFO counts %d samples, frames hold %d", total, len(samples))
+	}
+	hash := md5.New()
+	for _, sample := range samples {
+		binary.Write(hash, binary.LittleEndian, sample)
+	}
+	if !bytes.Equal(hash.Sum(nil), sum) {
+		t.Error("STREAMINFO MD5 does not match the decoded samples")
+	}
+	return sampleRate, samples
+}
+
+func decodeSubframe(t *testing.T, r *bitReader, blockSize int) []int16 {
+	t.Helper()
+
+	if r.read(t, 1) != 0 {
+		t.Fatal("subframe padding bit set")
+	}
+	kind := r.read(t, 6)
+	if r.read(t, 1) != 0 {
+		t.Fatal("subframe has wasted bits")
+	}
+
+	block := make([]int32, 0, blockSize)
+	if kind == flacSubframeVerbatim {
+		for range blockSize {
+			block = append(block, r.signed(t, flacBitsPerSample))
+		}
+		return toInt16(block)
+	}
+	if kind&^0x07 != flacSubframeFixed || kind&0x07 > maxFixedOrder {
+		t.Fatalf("unexpected subframe type %#x", kind)
+	}
+
+	order := int(kind & 0x07)
+	for range order {
+		block = append(block, r.signed(t, flacBitsPerSample))
+	}
+	if method := r.read(t, 2); method != 0 {
+		t.Fatalf("residual coding method %d, want 4-bit rice parameters", method)
+	}
+	partitionOrder := r.read(t, 4)
+	partitionSize := blockSize >> partitionOrder
+	for i := 0; i < 1<<partitionOrder; i++ {
+		k := uint(r.read(t, 4))
+		if k == 15 {
+			t.Fatal("escaped rice partition")
+		}
+		n := partitionSize
+		if i == 0 {
+			n -= order
+		}
+		for range n {
+			u := r.unary(t)<<k | r.read(t, k)
+			residual := int64(u>>1) ^ -int64(u&1)
+			block = append(block, int32(fixedPrediction(block, order)+residual))
+		}
+	}
+	if len(block) != blockSize {
+		t.Fatalf("subframe holds %d samples, want %d", len(block), blockSize)
+	}
+	return toInt16(block)
+}
+
+// fixedPrediction predicts the sample after x with the fixed polynomial
+// predictor of order, the inverse of fixedResidual.
+func fixedPrediction(x []int32, order int) int64 {
+	i := len(x)
+	switch order {
+	case 1:
+		return int64(x[i-1])
+	case 2:
+		return 2*int64(x[i-1]) - int64(x[i-2])
+	case 3:
+		return 3*int64(x[i-1]) - 3*int64(x[i-2]) + int64(x[i-3])
+	case 4:
+		return 4*int64(x[i-1]) - 6*int64(x[i-2]) + 4*int64(x[i-3]) - int64(x[i-4])
+	}
+	return 0
+}
+
+func toInt16(block []int32) []int16 {
+	samples := make([]int16, len(block))
+	for i, sample := range block {
+		if sample < math.MinInt16 || sample > math.MaxInt16 {
+			panic("decoded sample out of 16-bit range")
+		}
+		samples[i] = int16(sample)
+	}
+	return samples
+}
+
+// testSignals returns n samples of signals that take the encoder down its
+// different paths: silence, a tone it predicts well, noise it can only store
+// verbatim and a square wave between the extremes.
+func testSignals(n int) map[string][]int16 {
+	random := rand.New(rand.NewSource(1))
+	signals := map[string][]int16{}
+	for _, name := range []string{"silence", "tone", "noise", "full scale"} {
+		signal := make([]int16, n)
+		for i := range signal {
+			switch name {
+			case "tone":
+				signal[i] = int16(12000 * math.Sin(2*math.Pi*440*float64(i)/uploadSampleRate))
+			case "noise":
+				signal[i] = int16(random.Intn(1<<16) - 1<<15)
+			case "full scale":
+				signal[i] = math.MaxInt16
+				if i/7%2 == 1 {
+					signal[i] = math.MinInt16
+				}
+			}
+		}
+		signals[name] = signal
+	}
+	return signals
+}
+
+func TestFLACRoundTrip(t *testing.T) {
+	// empty, shorter than the predictor warm-up, odd, and a block plus or
+	// minus one
+	for _, n := range []int{0, 1, 3, 4, 5, 999, flacBlockSize - 1, flacBlockSize, flacBlockSize + 1, 3*flacBlockSize + 777} {
+		for name, signal := range testSignals(n) {
+			path := filepath.Join(t.TempDir(), "test.flac")
+			writer, err := createFLAC(path, uploadSampleRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// written in uneven pieces, as encodeSpeech hands them over
+			for rest := signal; len(rest) > 0; {
+				piece := min(len(rest), 1001)
+				if err := writer.Write(rest[:piece]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[piece:]
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			rate, decoded := decodeFLAC(t, path)
+			if rate != uploadSampleRate {
+				t.Errorf("%s, %d samples: sample rate %d, want %d", name, n, rate, uploadSampleRate)
+			}
+			if !slices.Equal(decoded, signal) {
+				t.Errorf("%s, %d samples: decoded %d samples that differ from the %d encoded", name, n, len(decoded), len(signal))
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// every stage after capture works on signed 16-bit samples
+const bitsPerSample = 16
+
+// capture_format presets
+const (
+	standardFormat = "standard"
+	// captures at the rate recordings are uploaded at, so they need no
+	// resampling and take a third of the memory and disk
+	speechFormat = "speech"
+)
+
+var captureFormatPresets = map[string]wavFormat{
+	standardFormat: {SampleRate: 44100, Channels: 1, BitsPerSample: bitsPerSample},
+	speechFormat:   {SampleRate: uploadSampleRate, Channels: 1, BitsPerSample: bitsPerSample},
+}
+
+// captureFormat resolves the capture_format preset and the sample_rate and
+// channels settings that override it.
+func captureFormat(config *Config) (wavFormat, error) {
+	format, ok := captureFormatPresets[config.GetCaptureFormat()]
+	if !ok {
+		return wavFormat{}, fmt.Errorf("unknown capture format %q, use %q or %q", config.GetCaptureFormat(), standardFormat, speechFormat)
+	}
+
+	if config.SampleRate != 0 {
+		if config.SampleRate < 8000 || config.SampleRate > 192000 {
+			return wavFormat{}, fmt.Errorf("sample rate must be between 8000 and 192000 Hz, got %d", config.SampleRate)
+		}
+		format.SampleRate = config.SampleRate
+	}
+	if config.Channels != 0 {
+		if config.Channels != 1 && config.Channels != 2 {
+			return wavFormat{}, fmt.Errorf("channels must be 1 or 2, got %d", config.Channels)
+		}
+		format.Channels = config.Channels
+	}
+	return format, nil
+}
+
+func (f wavFormat) String() string {
+	return fmt.Sprintf("%d Hz/%d ch/%d bit", f.SampleRate, f.Channels, f.BitsPerSample)
+}
+
+// blockAlign is the size of one sample across all channels.
+func (f wavFormat) blockAlign() int {
+	return f.Channels * f.BitsPerSample / 8
+}
+
+func (f wavFormat) byteRate() int {
+	return f.SampleRate * f.blockAlign()
+}
+
+// duration is how long size bytes of audio in this format play.
+func (f wavFormat) duration(size int64) time.Duration {
+	return time.Duration(size) * time.Second / time.Duration(f.byteRate())
+}
+
+// offset is the inverse of duration for a position in seconds, rounded to a
+// whole sample.
+func (f wavFormat) offset(seconds float64) int64 {
+	return int64(math.Round(seconds*float64(f.SampleRate))) * int64(f.blockAlign())
+}
@@ -0,0 +1,135 @@
+package gui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// soundPeak separates sound from an empty room for the silence auto-stop. It
+// sits well above fan hum and well below speech.
+const soundPeak = 0.02
+
+func (g *App) createAutoStopContent() *fyne.Container {
+	g.durationEntry = widget.NewEntry()
+	g.durationEntry.SetPlaceHolder("off")
+	if minutes := g.config.GetMaxDurationMinutes(); minutes > 0 {
+		g.durationEntry.SetText(strconv.Itoa(minutes))
+	}
+
+	g.silenceEntry = widget.NewEntry()
+	g.silenceEntry.SetPlaceHolder("off")
+	if minutes := g.config.GetSilenceStopMinutes(); minutes > 0 {
+		g.silenceEntry.SetText(strconv.Itoa(minutes))
+	}
+
+	g.stopAtEntry = widget.NewEntry()
+	g.stopAtEntry.SetPlaceHolder("HH:MM")
+	g.stopAtEntry.SetText(g.config.GetStopAt())
+
+	saveBtn := g.createElevatedButton("Save", widget.MediumImportance, g.saveAutoStop)
+
+	return container.NewVBox(
+		widget.NewLabel("Max duration (minutes)"),
+		g.durationEntry,
+		widget.NewLabel("Stop after silence (minutes)"),
+		g.silenceEntry,
+		widget.NewLabel("Stop at"),
+		g.stopAtEntry,
+		saveBtn,
+	)
+}
+
+func (g *App) saveAutoStop() {
+	maxDuration, err := parseMinutes(g.durationEntry.Text)
+	if err != nil {
+		g.showError("Invalid Max Duration", err)
+		return
+	}
+
+	silenceStop, err := parseMinutes(g.silenceEntry.Text)
+	if err != nil {
+		g.showError("Invalid Silence Limit", err)
+		return
+	}
+
+	stopAt := strings.TrimSpace(g.stopAtEntry.Text)
+	if stopAt != "" {
+		if _, err := time.Parse("15:04", stopAt); err != nil {
+			g.showError("Invalid Stop Time", fmt.Errorf("use 24-hour HH:MM, e.g. 18:30"))
+			return
+		}
+	}
+
+	g.config.SetMaxDurationMinutes(maxDuration)
+	g.config.SetSilenceStopMinutes(silenceStop)
+	g.config.SetStopAt(stopAt)
+	if err := g.config.Save(); err != nil {
+		g.showError("Auto-stop Save Error", err)
+		return
+	}
+
+	// a recording in progress picks up the new stop time right away
+	if g.isRecording {
+		g.stopAt = nextStopTime(stopAt, g.startTime)
+	}
+
+	dialog.ShowInformation("Saved", "Auto-stop rules have been saved.", g.window)
+}
+
+// autoStopReason returns why the current recording should end, or "" while
+// none of the auto-stop rules apply. Like the state it reads, it belongs to
+// the UI goroutine.
+func (g *App) autoStopReason() string {
+	if minutes := g.config.GetMaxDurationMinutes(); minutes > 0 && g.recordedDuration() >= time.Duration(minutes)*time.Minute {
+		return fmt.Sprintf("Max duration of %d min reached", minutes)
+	}
+
+	if minutes := g.config.GetSilenceStopMinutes(); minutes > 0 && !g.isPaused && time.Since(g.lastSound) >= time.Duration(minutes)*time.Minute {
+		return fmt.Sprintf("No sound for %d min", minutes)
+	}
+
+	if !g.stopAt.IsZero() && !time.Now().Before(g.stopAt) {
+		return "Scheduled stop at " + g.stopAt.Format("15:04")
+	}
+
+	return ""
+}
+
+func parseMinutes(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+
+	minutes, err := strconv.Atoi(text)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("enter a whole number of minutes or leave empty")
+	}
+	return minutes, nil
+}
+
+// nextStopTime returns the first time after start that the HH:MM clock
+// reads, so a stop time earlier than the start means the next day.
+func nextStopTime(clock string, start time.Time) time.Time {
+	if clock == "" {
+		return time.Time{}
+	}
+
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}
+	}
+
+	stop := time.Date(start.Year(), start.Month(), start.Day(), parsed.Hour(), parsed.Minute(), 0, 0, start.Location())
+	if !stop.After(start) {
+		stop = stop.AddDate(0, 0, 1)
+	}
+	return stop
+}
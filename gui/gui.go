@@ -3,6 +3,7 @@ package gui
 import (
 	"fmt"
 	"image/color"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,31 +20,148 @@ import (
 
 type AudioRecorder interface {
 	StartRecording() error
-	StopRecording() error
+	RecordStream(url string) error
+	StopRecording(reason string) error
+	Pause() error
+	Resume() error
+	AddMarker(label string) error
 	SaveAudio(sessionDir string) (string, error)
-	GetAudioData() []byte
+	ImportAudio(path, workDir string, startTime time.Time) (string, error)
+	MediaCreationTime(path string) time.Time
+	GetAudioSize() int64
+	Levels() <-chan AudioLevel
+	Status() <-chan RecorderStatus
+	ListInputDevices() ([]InputDevice, error)
 	InitializeAudio() error
+	Arm(minutes int) error
+	Disarm()
+	GetStartTime() time.Time
+	Session() int64
+}
+
+// AudioLevel is a short-window reading of the microphone input, with RMS and
+// peak relative to full scale.
+type AudioLevel struct {
+	RMS      float64
+	Peak     float64
+	Clipping bool
+}
+
+// RecorderStatusKind tells what a RecorderStatus reports.
+type RecorderStatusKind int
+
+const (
+	// StatusCaptureStopped means a capture tool or device stopped delivering
+	// audio while it was still needed.
+	StatusCaptureStopped RecorderStatusKind = iota
+	// StatusWriteFailed means captured audio could not be written to disk.
+	StatusWriteFailed
+	// StatusToolOutput carries a line a capture tool printed to stderr.
+	StatusToolOutput
+	// StatusPoorQuality means a finished recording or segment sounds bad
+	// enough to affect the transcript; Message lists why.
+	StatusPoorQuality
+)
+
+// RecorderStatus is a capture problem reported by the recorder as it
+// happens. Fatal is set when the microphone track itself is lost. Session is
+// the capture it is about, as returned by AudioRecorder.Session, or 0 for a
+// report on a finished file, like a poor quality warning.
+type RecorderStatus struct {
+	Kind    RecorderStatusKind
+	Session int64
+	Track   string
+	Message string
+	Fatal   bool
+}
+
+type InputDevice struct {
+	ID   string
+	Name string
 }
 
 type Config interface {
 	HasValidToken() bool
+	CanTranscribe(model string) bool
 	GetOpenAIAPIKey() string
 	GetSaveLocation() string
 	GetLanguage() string
 	GetModel() string
+	GetInputDevice() string
+	GetCaptureSystemAudio() bool
+	GetTrimSilence() bool
+	GetHighPassFilter() bool
+	GetNoiseReduction() bool
+	GetNormalizeLoudness() bool
+	GetMaxDurationMinutes() int
+	GetSilenceStopMinutes() int
+	GetStopAt() string
+	GetRollingBufferMinutes() int
+	GetCaptureFormat() string
 	SetOpenAIAPIKey(key string)
 	SetSaveLocation(location string)
 	SetLanguage(language string)
 	SetModel(model string)
+	SetInputDevice(device string)
+	SetCaptureSystemAudio(enabled bool)
+	SetTrimSilence(enabled bool)
+	SetHighPassFilter(enabled bool)
+	SetNoiseReduction(enabled bool)
+	SetNormalizeLoudness(enabled bool)
+	SetMaxDurationMinutes(minutes int)
+	SetSilenceStopMinutes(minutes int)
+	SetStopAt(clock string)
+	SetRollingBufferMinutes(minutes int)
+	SetCaptureFormat(format string)
 	Save() error
 }
 
 type AIProcessor interface {
 	ProcessAudio(audioFile, outputDir, language, model string, startTime time.Time) (summary, title, finalAudioPath string, err error)
+	ListLocalModels() ([]TranscriptionModel, error)
+	Progress() <-chan TranscriptionProgress
+}
+
+// TranscriptionProgress reports that chunk Chunk of a recording too long for
+// one upload has been transcribed, Done of its Total chunks so far. Chunks
+// finish in any order.
+type TranscriptionProgress struct {
+	File  string
+	Chunk int
+	Done  int
+	Total int
+}
+
+// TranscriptionModel is a model that runs on this machine. ID is what the
+// model setting holds to select it.
+type TranscriptionModel struct {
+	ID   string
+	Name string
+	// Backend is the tool a local model runs in, e.g. "whisper.cpp"
+	Backend string
+}
+
+// PendingSession is a recording left behind by a run that was interrupted
+// before its summary was saved.
+type PendingSession struct {
+	Path      string
+	StartTime time.Time
+	Stage     string
+}
+
+type SessionRecovery interface {
+	NewWorkDir(startTime time.Time) (string, error)
+	FindPendingSessions() ([]PendingSession, error)
+	PrepareSession(session PendingSession) (audioFile string, err error)
+	DiscardSession(session PendingSession) error
 }
 
 type SaveSummaryFunc func(title, summary string, meetingDate time.Time, sessionDir string) (string, error)
 
+// errTokenRequired is shown when the selected model is transcribed in the
+// cloud and no API token is set.
+var errTokenRequired = fmt.Errorf("please enter your OpenAI API token first, or pick a local model")
+
 var (
 	primaryColor     = color.NRGBA{R: 33, G: 150, B: 243, A: 255}  // Blue
 	backgroundColor  = color.NRGBA{R: 250, G: 250, B: 250, A: 255} // Light Gray
@@ -95,21 +213,45 @@ type App struct {
 	recorder        AudioRecorder
 	config          Config
 	aiProcessor     AIProcessor
+	recovery        SessionRecovery
 	recordBtn       *widget.Button
+	pauseBtn        *widget.Button
+	importBtn       *widget.Button
+	streamBtn       *widget.Button
+	markerBtn       *widget.Button
+	markerEntry     *widget.Entry
 	statusLabel     *widget.Label
 	timeLabel       *widget.Label
 	sizeLabel       *widget.Label
+	levelBar        *widget.ProgressBar
+	signalWarning   *widget.Label
+	captureStatus   *widget.Label
 	tokenEntry      *widget.Entry
 	folderLabel     *widget.Label
 	languageSelect  *widget.Select
 	modelSelect     *widget.Select
+	// localModels maps the model selector's labels of local models to IDs
+	localModels     map[string]string
+	deviceSelect    *widget.Select
+	formatSelect    *widget.Select
+	inputDevices    []InputDevice
 	startTime       time.Time
 	ticker          *time.Ticker
 	isRecording     bool
+	isArmed         bool
+	isPaused        bool
+	pausedAt        time.Time
+	pausedTotal     time.Duration
+	lastSound       time.Time
+	stopAt          time.Time
+	durationEntry   *widget.Entry
+	silenceEntry    *widget.Entry
+	stopAtEntry     *widget.Entry
+	bufferEntry     *widget.Entry
 	saveSummaryFunc SaveSummaryFunc
 }
 
-func NewApp(recorder AudioRecorder, config Config, aiProcessor AIProcessor, saveSummaryFunc SaveSummaryFunc) *App {
+func NewApp(recorder AudioRecorder, config Config, aiProcessor AIProcessor, recovery SessionRecovery, saveSummaryFunc SaveSummaryFunc) *App {
 	myApp := app.New()
 	myApp.Settings().SetTheme(&materialTheme{})
 	myApp.SetIcon(ResourceIconSvg)
@@ -125,6 +267,7 @@ func NewApp(recorder AudioRecorder, config Config, aiProcessor AIProcessor, save
 		recorder:        recorder,
 		config:          config,
 		aiProcessor:     aiProcessor,
+		recovery:        recovery,
 		saveSummaryFunc: saveSummaryFunc,
 	}
 }
@@ -153,14 +296,13 @@ func (g *App) createElevatedButton(text string, importance widget.ButtonImportan
 	return btn
 }
 
-func (g *App) createStatChip(label, value string) *fyne.Container {
+func (g *App) createStatChip(label string, valueWidget *widget.Label) *fyne.Container {
 	bg := canvas.NewRectangle(color.NRGBA{R: 245, G: 245, B: 245, A: 255})
 	bg.CornerRadius = 12
 	
 	labelWidget := widget.NewLabel(label)
 	labelWidget.TextStyle = fyne.TextStyle{Bold: true}
 	
-	valueWidget := widget.NewLabel(value)
 	valueWidget.Alignment = fyne.TextAlignCenter
 	
 	content := container.NewHBox(labelWidget, valueWidget)
@@ -179,7 +321,24 @@ func (g *App) setupUI() {
 	g.timeLabel = widget.NewLabel("00:00")
 	g.sizeLabel = widget.NewLabel("0.0 MB")
 	
+	g.levelBar = widget.NewProgressBar()
+	g.levelBar.TextFormatter = func() string { return "" }
+	
+	g.signalWarning = widget.NewLabel("")
+	g.signalWarning.Importance = widget.DangerImportance
+	g.signalWarning.Wrapping = fyne.TextWrapWord
+	g.signalWarning.Hide()
+	
+	g.captureStatus = widget.NewLabel("")
+	g.captureStatus.Importance = widget.WarningImportance
+	g.captureStatus.Wrapping = fyne.TextWrapWord
+	g.captureStatus.Hide()
+	
 	g.recordBtn = g.createElevatedButton("🎙️ Start Recording", widget.HighImportance, g.toggleRecording)
+	g.pauseBtn = g.createElevatedButton("⏸️ Pause", widget.MediumImportance, g.togglePause)
+	g.pauseBtn.Disable()
+	g.importBtn = g.createElevatedButton("📂 Import File", widget.MediumImportance, g.selectImportFile)
+	g.streamBtn = g.createElevatedButton("🌐 Record from URL", widget.MediumImportance, g.selectStreamURL)
 	
 	g.tokenEntry = widget.NewPasswordEntry()
 	g.tokenEntry.SetPlaceHolder("Enter OpenAI API key...")
@@ -215,6 +374,23 @@ func (g *App) setupUI() {
 		"gpt-4o-transcribe (improved accuracy)", 
 		"gpt-4o-mini-transcribe (fast & efficient)",
 	}
+	
+	// local models are listed after the cloud ones
+	localModels, err := g.aiProcessor.ListLocalModels()
+	if err != nil {
+		fmt.Printf("Warning: failed to list local models: %v\n", err)
+	}
+	g.localModels = make(map[string]string)
+	for _, model := range localModels {
+		label := fmt.Sprintf("%s (local, %s)", model.Name, model.Backend)
+		// the label is all onModelChanged has to go by, so a model named like
+		// another is told apart rather than hiding it
+		for n := 2; g.localModels[label] != ""; n++ {
+			label = fmt.Sprintf("%s (local, %s, %d)", model.Name, model.Backend, n)
+		}
+		models = append(models, label)
+		g.localModels[label] = model.ID
+	}
 	g.modelSelect = widget.NewSelect(models, g.onModelChanged)
 	
 	currentModel := g.config.GetModel()
@@ -226,38 +402,94 @@ func (g *App) setupUI() {
 	case "gpt-4o-mini-transcribe":
 		g.modelSelect.SetSelected("gpt-4o-mini-transcribe (fast & efficient)")
 	default:
-		g.modelSelect.SetSelected("whisper-1 (standard model)")
+		selected := "whisper-1 (standard model)"
+		for label, id := range g.localModels {
+			if id == currentModel {
+				selected = label
+			}
+		}
+		g.modelSelect.SetSelected(selected)
+	}
+	
+	g.deviceSelect = widget.NewSelect([]string{defaultDeviceLabel}, g.onDeviceChanged)
+	refreshDevicesBtn := g.createElevatedButton("🔄", widget.LowImportance, g.refreshDevices)
+	g.refreshDevices()
+	
+	systemAudioCheck := widget.NewCheck("Capture system audio", g.onSystemAudioChanged)
+	systemAudioCheck.SetChecked(g.config.GetCaptureSystemAudio())
+	
+	formats := []string{
+		"standard (44.1 kHz)",
+		"speech (16 kHz, smaller files)",
+	}
+	g.formatSelect = widget.NewSelect(formats, g.onCaptureFormatChanged)
+	for _, format := range formats {
+		if strings.HasPrefix(format, g.config.GetCaptureFormat()+" ") {
+			g.formatSelect.SetSelected(format)
+		}
 	}
 	
+	trimSilenceCheck := widget.NewCheck("Trim long silences before upload", g.onTrimSilenceChanged)
+	trimSilenceCheck.SetChecked(g.config.GetTrimSilence())
+	
+	highPassCheck := widget.NewCheck("Remove rumble and hum", g.onHighPassChanged)
+	highPassCheck.SetChecked(g.config.GetHighPassFilter())
+	
+	noiseReductionCheck := widget.NewCheck("Reduce background noise", g.onNoiseReductionChanged)
+	noiseReductionCheck.SetChecked(g.config.GetNoiseReduction())
+	
+	normalizeCheck := widget.NewCheck("Normalize loudness", g.onNormalizeLoudnessChanged)
+	normalizeCheck.SetChecked(g.config.GetNormalizeLoudness())
+	
 	optionsContent := container.NewVBox(
 		widget.NewLabel("Language"),
 		g.languageSelect,
 		widget.NewLabel("Model"),
 		g.modelSelect,
+		widget.NewLabel("Input Device"),
+		container.NewBorder(nil, nil, nil, refreshDevicesBtn, g.deviceSelect),
+		widget.NewLabel("Capture Format"),
+		g.formatSelect,
+		systemAudioCheck,
+		trimSilenceCheck,
+		highPassCheck,
+		noiseReductionCheck,
+		normalizeCheck,
 	)
 	
 	statsContainer := container.NewGridWithColumns(2,
-		g.createStatChip("⏱", "00:00"),
-		g.createStatChip("💾", "0.0 MB"),
+		g.createStatChip("⏱", g.timeLabel),
+		g.createStatChip("💾", g.sizeLabel),
 	)
 
 	recordingContent := container.NewVBox(
 		g.statusLabel,
 		statsContainer,
+		g.levelBar,
+		g.signalWarning,
+		g.captureStatus,
 		g.recordBtn,
+		g.pauseBtn,
+		g.createMarkerContent(),
+		g.importBtn,
+		g.streamBtn,
 	)
 	
 	content := container.NewVBox(
 		g.createCard("🎯 Recording", recordingContent),
+		g.createCard("⏪ Rolling Buffer", g.createRollingBufferContent()),
 		g.createCard("🔑 Auth", tokenContent),
 		g.createCard("💾 Storage", storageContent),
 		g.createCard("⚙️ Options", optionsContent),
+		g.createCard("⏹ Auto-stop", g.createAutoStopContent()),
 	)
 	
 	scroll := container.NewScroll(content)
 	scroll.SetMinSize(fyne.NewSize(320, 480))
 	
 	g.window.SetContent(scroll)
+	g.window.Canvas().AddShortcut(markerShortcut, func(fyne.Shortcut) { g.addMarker() })
+	g.window.SetOnDropped(g.onFilesDropped)
 }
 
 func (g *App) Run() {
@@ -268,8 +500,14 @@ func (g *App) Run() {
 	}
 	
 	g.updateFolderDisplay()
+	g.checkPendingSessions()
+	go g.monitorStatus(g.recorder.Status())
+	go g.monitorProgress(g.aiProcessor.Progress())
+	g.armBuffer()
+	g.showIdle()
 	
 	g.window.ShowAndRun()
+	g.recorder.Disarm()
 }
 
 func (g *App) saveToken() {
@@ -295,13 +533,13 @@ func (g *App) toggleRecording() {
 	if !g.isRecording {
 		g.startRecording()
 	} else {
-		g.stopRecording()
+		g.stopRecording("Stopped manually")
 	}
 }
 
 func (g *App) startRecording() {
-	if !g.config.HasValidToken() {
-		g.showError("Authentication Required", fmt.Errorf("please enter your OpenAI API token first"))
+	if !g.config.CanTranscribe(g.config.GetModel()) {
+		g.showError("Authentication Required", errTokenRequired)
 		return
 	}
 	
@@ -315,66 +553,213 @@ func (g *App) startRecording() {
 		return
 	}
 	
+	g.showRecording()
+}
+
+// showRecording switches the controls over to a recording that has started.
+func (g *App) showRecording() {
 	g.isRecording = true
-	g.startTime = time.Now()
+	g.isArmed = false
+	g.isPaused = false
+	g.pausedTotal = 0
+	g.startTime = g.recorder.GetStartTime()
+	g.lastSound = time.Now()
+	g.stopAt = nextStopTime(g.config.GetStopAt(), g.startTime)
 	g.recordBtn.SetText("⏹️ Stop Recording")
 	g.recordBtn.Importance = widget.DangerImportance
+	g.pauseBtn.SetText("⏸️ Pause")
+	g.pauseBtn.Enable()
+	g.importBtn.Disable()
+	g.streamBtn.Disable()
+	g.captureStatus.Hide()
+	g.markerBtn.Enable()
+	g.markerEntry.SetPlaceHolder(markerPlaceHolder)
 	g.statusLabel.SetText("🔴 Recording in progress...")
 	
 	g.ticker = time.NewTicker(time.Second)
-	go g.updateStats()
+	go g.updateStats(g.ticker)
+	go g.monitorLevels(g.recorder.Levels())
 }
 
-func (g *App) stopRecording() {
-	if g.ticker != nil {
-		g.ticker.Stop()
-	}
-	
-	if err := g.recorder.StopRecording(); err != nil {
+func (g *App) stopRecording(reason string) {
+	err := g.recorder.StopRecording(reason)
+	g.showStopped()
+	if err != nil {
 		g.showError("Stop Recording Failed", err)
 		return
 	}
+	g.statusLabel.SetText("📦 Compressing & processing...")
 	
+	go g.processRecording(g.startTime)
+}
+
+// showStopped switches the controls back once a recording has ended, or
+// failed to end and cannot continue.
+func (g *App) showStopped() {
+	if g.ticker != nil {
+		g.ticker.Stop()
+	}
 	g.isRecording = false
+	g.isPaused = false
 	g.recordBtn.SetText("🎙️ Start Recording")
 	g.recordBtn.Importance = widget.HighImportance
-	g.statusLabel.SetText("📦 Compressing & processing...")
+	g.pauseBtn.Disable()
+	g.importBtn.Enable()
+	g.streamBtn.Enable()
+	g.markerBtn.Disable()
+}
+
+func (g *App) togglePause() {
+	if !g.isRecording {
+		return
+	}
 	
-	go g.processRecording()
+	if !g.isPaused {
+		if err := g.recorder.Pause(); err != nil {
+			g.showError("Pause Failed", err)
+			return
+		}
+		g.isPaused = true
+		g.pausedAt = time.Now()
+		g.pauseBtn.SetText("▶️ Resume")
+		g.statusLabel.SetText("⏸️ Recording paused")
+		return
+	}
+	
+	if err := g.recorder.Resume(); err != nil {
+		g.showError("Resume Failed", err)
+		return
+	}
+	g.isPaused = false
+	g.pausedTotal += time.Since(g.pausedAt)
+	g.pauseBtn.SetText("⏸️ Pause")
+	g.statusLabel.SetText("🔴 Recording in progress...")
 }
 
-func (g *App) updateStats() {
-	for range g.ticker.C {
-		if !g.isRecording {
-			break
+// recordedDuration is the time spent recording, not counting pauses.
+func (g *App) recordedDuration() time.Duration {
+	elapsed := time.Since(g.startTime) - g.pausedTotal
+	if g.isPaused {
+		elapsed -= time.Since(g.pausedAt)
+	}
+	return elapsed
+}
+
+// updateStats shows the time and size of the recording every tick and ends
+// it when an auto-stop rule applies. The recording's state belongs to the UI,
+// so each tick is handled there.
+func (g *App) updateStats(ticker *time.Ticker) {
+	for range ticker.C {
+		done := false
+		fyne.DoAndWait(func() {
+			if !g.isRecording || g.ticker != ticker {
+				done = true
+				return
+			}
+			
+			elapsed := g.recordedDuration()
+			g.timeLabel.SetText(fmt.Sprintf("%02d:%02d", 
+				int(elapsed.Minutes()), 
+				int(elapsed.Seconds())%60))
+			
+			audioSize := float64(g.recorder.GetAudioSize()) / 1024 / 1024
+			g.sizeLabel.SetText(fmt.Sprintf("%.1f MB", audioSize))
+			
+			if reason := g.autoStopReason(); reason != "" {
+				g.stopRecording(reason)
+				g.statusLabel.SetText("⏹ " + reason + ", processing...")
+				done = true
+			}
+		})
+		if done {
+			return
 		}
-		
-		elapsed := time.Since(g.startTime)
-		duration := fmt.Sprintf("%02d:%02d", 
-			int(elapsed.Minutes()), 
-			int(elapsed.Seconds())%60)
-		
-		audioSize := float64(len(g.recorder.GetAudioData())) / 1024 / 1024
-		
+	}
+}
+
+const (
+	silenceWarningDelay = 10 * time.Second
+	clippingWarningHold = 2 * time.Second
+	// digital silence: nothing above the lowest bit or two of the signal
+	silencePeak = 2.0 / 32768
+)
+
+// monitorLevels drives the level bar and warns when the input has been
+// silent or clipping, until the recorder closes the channel.
+func (g *App) monitorLevels(levels <-chan AudioLevel) {
+	// the state below is only touched on the UI goroutine, which also owns
+	// isPaused and lastSound
+	lastSignal := time.Now()
+	var lastClipping time.Time
+	warned := false
+	
+	for level := range levels {
+		now := time.Now()
 		fyne.Do(func() {
-			g.timeLabel.SetText(duration)
-			g.sizeLabel.SetText(fmt.Sprintf("%.1f MB", audioSize))
+			if level.Peak > silencePeak || g.isPaused {
+				lastSignal = now
+			}
+			if level.Peak > soundPeak || g.isPaused {
+				g.lastSound = now
+			}
+			if level.Clipping {
+				lastClipping = now
+			}
+			
+			warning := ""
+			switch {
+			case now.Sub(lastSignal) >= silenceWarningDelay:
+				warning = fmt.Sprintf("⚠️ No signal for %d s — is the microphone muted?", int(now.Sub(lastSignal).Seconds()))
+			case now.Sub(lastClipping) < clippingWarningHold:
+				warning = "⚠️ Input is clipping — lower the microphone gain"
+			}
+			
+			if warning != "" && !warned {
+				g.app.SendNotification(fyne.NewNotification("StoryShort", warning))
+			}
+			warned = warning != ""
+			
+			g.levelBar.SetValue(levelToBar(level.RMS))
+			if warning == "" {
+				g.signalWarning.Hide()
+				return
+			}
+			g.signalWarning.SetText(warning)
+			g.signalWarning.Show()
 		})
 	}
+	
+	fyne.Do(func() {
+		g.levelBar.SetValue(0)
+		g.signalWarning.Hide()
+	})
+}
+
+// levelToBar maps an RMS level onto a -60..0 dBFS scale.
+func levelToBar(rms float64) float64 {
+	if rms <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(rms)
+	return math.Max(0, math.Min(1, (db+60)/60))
 }
 
-func (g *App) processRecording() {
-	tempDir := filepath.Join(os.TempDir(), "temp_recording")
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
+// processRecording saves and processes the recording that started at
+// startTime, while the UI may already be recording the next one.
+func (g *App) processRecording(startTime time.Time) {
+	workDir, err := g.recovery.NewWorkDir(startTime)
+	if err != nil {
 		fyne.Do(func() {
 			g.showError("Temp Directory Creation Error", err)
 		})
 		return
 	}
 	
-	audioFile, err := g.recorder.SaveAudio(tempDir)
+	audioFile, err := g.recorder.SaveAudio(workDir)
+	fyne.Do(g.armBuffer)
 	if err != nil {
 		if err.Error() == "no_audio_data" {
+			os.RemoveAll(workDir)
 			fyne.Do(func() {
 				g.statusLabel.SetText("⚠️ No audio detected")
 				dialog.ShowInformation("Notice", "No audio was detected. Please try recording again.", g.window)
@@ -387,7 +772,11 @@ func (g *App) processRecording() {
 		return
 	}
 	
-	summary, title, finalAudioPath, err := g.aiProcessor.ProcessAudio(audioFile, g.config.GetSaveLocation(), g.config.GetLanguage(), g.config.GetModel(), g.startTime)
+	g.processAudioFile(audioFile, startTime)
+}
+
+func (g *App) processAudioFile(audioFile string, startTime time.Time) {
+	summary, title, finalAudioPath, err := g.aiProcessor.ProcessAudio(audioFile, g.config.GetSaveLocation(), g.config.GetLanguage(), g.config.GetModel(), startTime)
 	if err != nil {
 		fyne.Do(func() {
 			g.showError("OpenAI Processing Error", err)
@@ -396,7 +785,7 @@ func (g *App) processRecording() {
 	}
 	
 	sessionDir := filepath.Dir(finalAudioPath)
-	summaryFile, err := g.saveSummaryFunc(title, summary, g.startTime, sessionDir)
+	summaryFile, err := g.saveSummaryFunc(title, summary, startTime, sessionDir)
 	if err != nil {
 		fyne.Do(func() {
 			g.showError("Summary Save Error", err)
@@ -404,7 +793,7 @@ func (g *App) processRecording() {
 		return
 	}
 	
-	os.RemoveAll(tempDir)
+	os.RemoveAll(filepath.Dir(audioFile))
 	
 	fyne.Do(func() {
 		g.showResults(title, summaryFile, sessionDir)
@@ -421,7 +810,7 @@ func (g *App) showResults(title, _ string, sessionDir string) {
 	
 	g.timeLabel.SetText("00:00")
 	g.sizeLabel.SetText("0.0 MB")
-	g.statusLabel.SetText("Ready to record")
+	g.showIdle()
 }
 
 func (g *App) selectFolder() {
@@ -479,6 +868,9 @@ func (g *App) onModelChanged(modelWithDescription string) {
 		model = "gpt-4o-mini-transcribe"
 	default:
 		model = "whisper-1"
+		if id, ok := g.localModels[modelWithDescription]; ok {
+			model = id
+		}
 	}
 	
 	g.config.SetModel(model)
@@ -487,16 +879,104 @@ func (g *App) onModelChanged(modelWithDescription string) {
 	}
 }
 
+const defaultDeviceLabel = "System default"
+
+func (g *App) refreshDevices() {
+	devices, err := g.recorder.ListInputDevices()
+	if err != nil {
+		// the default input still works when the backend can't list devices
+		devices = nil
+	}
+	g.inputDevices = devices
+	
+	options := []string{defaultDeviceLabel}
+	selected := defaultDeviceLabel
+	for _, device := range devices {
+		options = append(options, device.Name)
+		if device.ID == g.config.GetInputDevice() {
+			selected = device.Name
+		}
+	}
+	
+	// a saved device that is unplugged shows as the default without being
+	// overwritten, so it is picked up again once it comes back
+	g.deviceSelect.Options = options
+	g.deviceSelect.Selected = selected
+	g.deviceSelect.Refresh()
+}
+
+func (g *App) onDeviceChanged(name string) {
+	device := ""
+	for _, d := range g.inputDevices {
+		if d.Name == name {
+			device = d.ID
+			break
+		}
+	}
+	
+	g.config.SetInputDevice(device)
+	if err := g.config.Save(); err != nil {
+		g.showError("Input Device Save Error", err)
+	}
+	g.rearmBuffer()
+}
+
+func (g *App) onSystemAudioChanged(enabled bool) {
+	g.config.SetCaptureSystemAudio(enabled)
+	if err := g.config.Save(); err != nil {
+		g.showError("System Audio Save Error", err)
+	}
+	g.rearmBuffer()
+}
+
+// onCaptureFormatChanged applies from the next recording; one in progress
+// keeps the format it started with.
+func (g *App) onCaptureFormatChanged(selected string) {
+	format, _, _ := strings.Cut(selected, " ")
+	if format == g.config.GetCaptureFormat() {
+		return
+	}
+	
+	g.config.SetCaptureFormat(format)
+	if err := g.config.Save(); err != nil {
+		g.showError("Capture Format Save Error", err)
+	}
+	g.rearmBuffer()
+}
+
+func (g *App) onTrimSilenceChanged(enabled bool) {
+	g.config.SetTrimSilence(enabled)
+	if err := g.config.Save(); err != nil {
+		g.showError("Silence Trimming Save Error", err)
+	}
+}
+
+func (g *App) onHighPassChanged(enabled bool) {
+	g.config.SetHighPassFilter(enabled)
+	if err := g.config.Save(); err != nil {
+		g.showError("High-pass Filter Save Error", err)
+	}
+}
+
+func (g *App) onNoiseReductionChanged(enabled bool) {
+	g.config.SetNoiseReduction(enabled)
+	if err := g.config.Save(); err != nil {
+		g.showError("Noise Reduction Save Error", err)
+	}
+}
+
+func (g *App) onNormalizeLoudnessChanged(enabled bool) {
+	g.config.SetNormalizeLoudness(enabled)
+	if err := g.config.Save(); err != nil {
+		g.showError("Loudness Normalization Save Error", err)
+	}
+}
+
+// showError reports err without touching a recording in progress, which
+// keeps running; failures that end one call showStopped first.
 func (g *App) showError(title string, err error) {
 	dialog.ShowError(fmt.Errorf("%s: %v", title, err), g.window)
-	g.statusLabel.SetText("❌ Error")
-	
-	if g.isRecording {
-		g.isRecording = false
-		g.recordBtn.SetText("🎙️ Start Recording")
-		g.recordBtn.Importance = widget.HighImportance
-		if g.ticker != nil {
-			g.ticker.Stop()
-		}
+	if !g.isRecording {
+		g.statusLabel.SetText("❌ Error")
 	}
 }
\ No newline at end of file
@@ -0,0 +1,78 @@
+package gui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+func (g *App) selectImportFile() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			g.showError("File Selection Error", err)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		reader.Close()
+
+		g.importFile(reader.URI().Path())
+	}, g.window)
+}
+
+func (g *App) onFilesDropped(_ fyne.Position, uris []fyne.URI) {
+	if len(uris) == 0 {
+		return
+	}
+	if len(uris) > 1 {
+		g.showError("Import Error", fmt.Errorf("drop one file at a time"))
+		return
+	}
+
+	g.importFile(uris[0].Path())
+}
+
+// importFile runs a file recorded elsewhere through the same pipeline as a
+// recording, dated by when the file itself was recorded.
+func (g *App) importFile(path string) {
+	if g.isRecording {
+		g.showError("Import Error", fmt.Errorf("stop the current recording before importing a file"))
+		return
+	}
+	if !g.config.CanTranscribe(g.config.GetModel()) {
+		g.showError("Authentication Required", errTokenRequired)
+		return
+	}
+
+	g.statusLabel.SetText(fmt.Sprintf("📥 Importing %s...", filepath.Base(path)))
+
+	go func() {
+		startTime := g.recorder.MediaCreationTime(path)
+		workDir, err := g.recovery.NewWorkDir(startTime)
+		if err != nil {
+			fyne.Do(func() {
+				g.showError("Temp Directory Creation Error", err)
+			})
+			return
+		}
+
+		audioFile, err := g.recorder.ImportAudio(path, workDir, startTime)
+		if err != nil {
+			os.RemoveAll(workDir)
+			fyne.Do(func() {
+				g.showIdle()
+				g.showError("Import Error", err)
+			})
+			return
+		}
+
+		fyne.Do(func() {
+			g.statusLabel.SetText("🤖 Transcribing & summarizing...")
+		})
+		g.processAudioFile(audioFile, startTime)
+	}()
+}
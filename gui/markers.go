@@ -0,0 +1,43 @@
+package gui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+)
+
+const markerPlaceHolder = "Marker label (optional)"
+
+// markerShortcut drops a marker from anywhere in the window except the label
+// entry, where Enter does the same.
+var markerShortcut = &desktop.CustomShortcut{KeyName: fyne.KeyM, Modifier: fyne.KeyModifierShortcutDefault}
+
+func (g *App) createMarkerContent() *fyne.Container {
+	g.markerEntry = widget.NewEntry()
+	g.markerEntry.SetPlaceHolder(markerPlaceHolder)
+	g.markerEntry.OnSubmitted = func(string) { g.addMarker() }
+
+	g.markerBtn = g.createElevatedButton("🔖 Mark", widget.MediumImportance, g.addMarker)
+	g.markerBtn.Disable()
+
+	return container.NewBorder(nil, nil, nil, g.markerBtn, g.markerEntry)
+}
+
+func (g *App) addMarker() {
+	if !g.isRecording {
+		return
+	}
+
+	if err := g.recorder.AddMarker(g.markerEntry.Text); err != nil {
+		// the recording goes on and the label stays for another try
+		g.showError("Marker Failed", err)
+		return
+	}
+
+	elapsed := g.recordedDuration()
+	g.markerEntry.SetText("")
+	g.markerEntry.SetPlaceHolder(fmt.Sprintf("🔖 Marked at %02d:%02d", int(elapsed.Minutes()), int(elapsed.Seconds())%60))
+}
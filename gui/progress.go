@@ -0,0 +1,21 @@
+package gui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+)
+
+// monitorProgress shows how far the transcription of a long recording has
+// got for as long as the app runs.
+func (g *App) monitorProgress(progress <-chan TranscriptionProgress) {
+	for report := range progress {
+		fyne.Do(func() {
+			// a new recording may have started while the last one is processed
+			if g.isRecording {
+				return
+			}
+			g.statusLabel.SetText(fmt.Sprintf("🤖 Transcribing %s: %d of %d parts done", report.File, report.Done, report.Total))
+		})
+	}
+}
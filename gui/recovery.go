@@ -0,0 +1,79 @@
+package gui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func (g *App) checkPendingSessions() {
+	sessions, err := g.recovery.FindPendingSessions()
+	if err != nil {
+		g.showError("Recovery Scan Error", err)
+		return
+	}
+	if len(sessions) == 0 {
+		return
+	}
+
+	g.showRecoveryDialog(sessions)
+}
+
+func (g *App) showRecoveryDialog(sessions []PendingSession) {
+	var recoveryDialog dialog.Dialog
+	rows := container.NewVBox()
+
+	for _, session := range sessions {
+		infoLabel := widget.NewLabel(fmt.Sprintf("%s\n%s",
+			session.StartTime.Format("2006-01-02 15:04"), session.Stage))
+
+		var row *fyne.Container
+		resumeBtn := g.createElevatedButton("▶️ Resume", widget.HighImportance, func() {
+			rows.Remove(row)
+			if len(rows.Objects) == 0 {
+				recoveryDialog.Hide()
+			}
+			g.resumeSession(session)
+		})
+		discardBtn := g.createElevatedButton("🗑 Discard", widget.DangerImportance, func() {
+			if err := g.recovery.DiscardSession(session); err != nil {
+				g.showError("Discard Error", err)
+				return
+			}
+			rows.Remove(row)
+			if len(rows.Objects) == 0 {
+				recoveryDialog.Hide()
+			}
+		})
+
+		row = container.NewBorder(nil, nil, nil, container.NewHBox(resumeBtn, discardBtn), infoLabel)
+		rows.Add(row)
+	}
+
+	content := container.NewVBox(
+		widget.NewLabel("These recordings were interrupted before their summary was saved:"),
+		rows,
+	)
+
+	recoveryDialog = dialog.NewCustom("♻️ Recover Sessions", "Later", content, g.window)
+	recoveryDialog.Show()
+}
+
+func (g *App) resumeSession(session PendingSession) {
+	g.statusLabel.SetText("♻️ Resuming interrupted session...")
+
+	go func() {
+		audioFile, err := g.recovery.PrepareSession(session)
+		if err != nil {
+			fyne.Do(func() {
+				g.showError("Recovery Error", err)
+			})
+			return
+		}
+
+		g.processAudioFile(audioFile, session.StartTime)
+	}()
+}
@@ -0,0 +1,111 @@
+package gui
+
+import (
+	"fmt"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func (g *App) createRollingBufferContent() *fyne.Container {
+	g.bufferEntry = widget.NewEntry()
+	g.bufferEntry.SetPlaceHolder("off")
+	if minutes := g.config.GetRollingBufferMinutes(); minutes > 0 {
+		g.bufferEntry.SetText(strconv.Itoa(minutes))
+	}
+
+	saveBtn := g.createElevatedButton("Save", widget.MediumImportance, g.saveRollingBuffer)
+
+	return container.NewVBox(
+		widget.NewLabel("Keep the last (minutes)"),
+		g.bufferEntry,
+		saveBtn,
+	)
+}
+
+func (g *App) saveRollingBuffer() {
+	minutes, err := parseMinutes(g.bufferEntry.Text)
+	if err != nil {
+		g.showError("Invalid Buffer Length", err)
+		return
+	}
+
+	previous := g.config.GetRollingBufferMinutes()
+	g.config.SetRollingBufferMinutes(minutes)
+
+	// a recording in progress keeps going, the new length applies once it ends
+	if !g.isRecording {
+		g.recorder.Disarm()
+		g.isArmed = false
+		g.armBuffer()
+		if minutes > 0 && !g.isArmed {
+			g.config.SetRollingBufferMinutes(previous)
+			g.armBuffer()
+			return
+		}
+		g.showIdle()
+	}
+
+	if err := g.config.Save(); err != nil {
+		g.showError("Rolling Buffer Save Error", err)
+		return
+	}
+
+	dialog.ShowInformation("Saved", "Rolling buffer has been saved.", g.window)
+}
+
+// armBuffer starts the rolling buffer when one is configured, so that Save
+// can keep audio from before it was pressed.
+func (g *App) armBuffer() {
+	minutes := g.config.GetRollingBufferMinutes()
+	if minutes <= 0 || g.isRecording {
+		return
+	}
+
+	if err := g.recorder.Arm(minutes); err != nil {
+		g.isArmed = false
+		g.showError("Rolling Buffer Error", err)
+		return
+	}
+	g.isArmed = true
+	g.updateRecordButton()
+}
+
+// rearmBuffer restarts an armed rolling buffer so it picks up changed capture
+// settings. The buffered audio is lost.
+func (g *App) rearmBuffer() {
+	if !g.isArmed {
+		return
+	}
+
+	g.recorder.Disarm()
+	g.isArmed = false
+	g.armBuffer()
+}
+
+// showIdle sets the status and record button for when nothing is recorded.
+func (g *App) showIdle() {
+	if g.isArmed {
+		g.statusLabel.SetText(fmt.Sprintf("⏪ Keeping the last %d min", g.config.GetRollingBufferMinutes()))
+	} else {
+		g.statusLabel.SetText("Ready to record")
+	}
+	g.updateRecordButton()
+}
+
+func (g *App) updateRecordButton() {
+	if g.isRecording {
+		return
+	}
+
+	if g.isArmed {
+		g.recordBtn.SetText(fmt.Sprintf("💾 Save Last %d min", g.config.GetRollingBufferMinutes()))
+	} else {
+		g.recordBtn.SetText("🎙️ Start Recording")
+	}
+	g.recordBtn.Importance = widget.HighImportance
+	g.recordBtn.Refresh()
+}
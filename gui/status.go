@@ -0,0 +1,58 @@
+package gui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// monitorStatus shows capture problems reported by the recorder for as long
+// as the app runs.
+func (g *App) monitorStatus(statuses <-chan RecorderStatus) {
+	for status := range statuses {
+		fyne.Do(func() {
+			g.showRecorderStatus(status)
+		})
+	}
+}
+
+func (g *App) showRecorderStatus(status RecorderStatus) {
+	// a capture that has since been replaced may still report, and must not
+	// stop the one that replaced it
+	if status.Session != 0 && status.Session != g.recorder.Session() {
+		return
+	}
+
+	if status.Kind == StatusToolOutput {
+		g.captureStatus.SetText(fmt.Sprintf("%s: %s", status.Track, status.Message))
+		g.captureStatus.Show()
+		return
+	}
+	if status.Kind == StatusPoorQuality {
+		g.captureStatus.SetText(fmt.Sprintf("⚠️ Poor audio in %s, the transcript may suffer: %s", status.Track, status.Message))
+		g.captureStatus.Show()
+		return
+	}
+
+	err := fmt.Errorf("%s capture failed: %s", status.Track, status.Message)
+	if status.Kind == StatusWriteFailed {
+		err = fmt.Errorf("%s could not be saved: %s", status.Track, status.Message)
+	}
+
+	switch {
+	case status.Fatal && g.isRecording:
+		// keep what was captured up to the failure
+		g.stopRecording("Capture failed: " + status.Message)
+		g.statusLabel.SetText("⚠️ Capture failed, processing what was recorded...")
+		dialog.ShowError(err, g.window)
+	case status.Fatal && g.isArmed:
+		g.recorder.Disarm()
+		g.isArmed = false
+		g.showIdle()
+		dialog.ShowError(fmt.Errorf("rolling buffer stopped: %w", err), g.window)
+	default:
+		g.captureStatus.SetText("⚠️ " + err.Error())
+		g.captureStatus.Show()
+	}
+}
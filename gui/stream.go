@@ -0,0 +1,42 @@
+package gui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+func (g *App) selectStreamURL() {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("https://, rtsp:// or rtmp://")
+
+	items := []*widget.FormItem{widget.NewFormItem("Stream URL", entry)}
+	dialog.ShowForm("Record from URL", "Record", "Cancel", items, func(confirmed bool) {
+		if confirmed {
+			g.recordStream(strings.TrimSpace(entry.Text))
+		}
+	}, g.window)
+}
+
+// recordStream records a live stream, such as a webinar, the way a recording
+// from the microphone is made, auto-stop rules included.
+func (g *App) recordStream(url string) {
+	if g.isRecording {
+		g.showError("Stream Error", fmt.Errorf("stop the current recording before recording a stream"))
+		return
+	}
+	if !g.config.CanTranscribe(g.config.GetModel()) {
+		g.showError("Authentication Required", errTokenRequired)
+		return
+	}
+
+	if err := g.recorder.RecordStream(url); err != nil {
+		g.showError("Stream Recording Failed", err)
+		return
+	}
+
+	g.showRecording()
+	g.statusLabel.SetText("🔴 Recording stream...")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportAudio decodes an audio or video file recorded elsewhere into
+// workDir/recording.wav, in the same format StoryShort records in, and
+// prepares it for upload like a finished recording. startTime is when the
+// file was recorded.
+func (ar *AudioRecorder) ImportAudio(path, workDir string, startTime time.Time) (string, error) {
+	if !isCommandAvailable("ffmpeg") {
+		return "", fmt.Errorf("importing files requires ffmpeg")
+	}
+
+	format, err := captureFormat(ar.config)
+	if err != nil {
+		return "", err
+	}
+
+	wavPath := filepath.Join(workDir, "recording.wav")
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-y", "-i", path, "-vn",
+		"-ac", fmt.Sprint(format.Channels), "-ar", fmt.Sprint(format.SampleRate), "-c:a", "pcm_s16le", wavPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(wavPath)
+		return "", fmt.Errorf("failed to decode %s: %w\n%s", filepath.Base(path), err, lastLines(string(out), 5))
+	}
+
+	file, err := os.Open(wavPath)
+	if err != nil {
+		return "", err
+	}
+	_, dataSize, err := wavData(file)
+	file.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read decoded audio: %w", err)
+	}
+	if dataSize == 0 {
+		os.Remove(wavPath)
+		return "", fmt.Errorf("%s has no audio", filepath.Base(path))
+	}
+
+	metadata := &sessionMetadata{
+		StartTime:    startTime,
+		EndTime:      startTime.Add(format.duration(dataSize)),
+		ImportedFrom: path,
+	}
+	if err := metadata.save(filepath.Join(workDir, sessionMetadataFile)); err != nil {
+		fmt.Printf("Warning: failed to save session metadata: %v\n", err)
+	}
+
+	return ar.prepareForUpload(wavPath), nil
+}
+
+// MediaCreationTime returns when a media file was recorded, taken from its
+// container metadata when ffprobe can read it and from the file's
+// modification time otherwise.
+func (ar *AudioRecorder) MediaCreationTime(path string) time.Time {
+	if isCommandAvailable("ffprobe") {
+		out, err := exec.Command("ffprobe", "-v", "quiet", "-show_entries", "format_tags=creation_time",
+			"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+		if err == nil {
+			if created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out))); err == nil {
+				return created.Local()
+			}
+		}
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// lastLines returns the last n lines of s, which is where ffmpeg puts the
+// reason it failed.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportZeroLengthWAV(t *testing.T) {
+	useFakeFFmpeg(t)
+
+	// a header with no samples after it, sized 0 like a WAV file whose
+	// writer never came back to fill in the size
+	path, _ := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0)
+	ar := newTestRecorder(t, "stdin")
+
+	workDir := t.TempDir()
+	audioFile, err := ar.ImportAudio(path, workDir, time.Now())
+	if err == nil {
+		t.Fatalf("importing a WAV file without samples gave %s", audioFile)
+	}
+	if !strings.Contains(err.Error(), "has no audio") {
+		t.Errorf("error = %v, want it to say the file has no audio", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "recording.wav")); !os.IsNotExist(err) {
+		t.Errorf("decoded file left behind: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, sessionMetadataFile)); !os.IsNotExist(err) {
+		t.Errorf("metadata saved for an empty import: %v", err)
+	}
+}
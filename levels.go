@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+// levelWindowsPerSecond is how often the recorder reports input levels.
+const levelWindowsPerSecond = 10
+
+// levelMeter measures RMS and peak levels of a 16-bit PCM stream and emits a
+// reading for every window of audio.
+type levelMeter struct {
+	windowSamples int
+	samples       int
+	sumSquares    float64
+	peak          int
+	clipped       int
+	carry         []byte
+}
+
+func newLevelMeter(format wavFormat) *levelMeter {
+	return &levelMeter{windowSamples: format.SampleRate * format.Channels / levelWindowsPerSecond}
+}
+
+func (m *levelMeter) write(pcm []byte, emit func(gui.AudioLevel)) {
+	// a read may end in the middle of a sample
+	if len(m.carry) > 0 {
+		pcm = append(m.carry, pcm...)
+		m.carry = nil
+	}
+	if len(pcm)%2 == 1 {
+		m.carry = []byte{pcm[len(pcm)-1]}
+		pcm = pcm[:len(pcm)-1]
+	}
+
+	for i := 0; i+1 < len(pcm); i += 2 {
+		sample := int(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		m.sumSquares += float64(sample * sample)
+
+		magnitude := sample
+		if magnitude < 0 {
+			magnitude = -magnitude
+		}
+		if magnitude > m.peak {
+			m.peak = magnitude
+		}
+		if magnitude >= math.MaxInt16 {
+			m.clipped++
+		}
+
+		m.samples++
+		if m.samples == m.windowSamples {
+			emit(m.level())
+			m.samples, m.sumSquares, m.peak, m.clipped = 0, 0, 0, 0
+		}
+	}
+}
+
+func (m *levelMeter) level() gui.AudioLevel {
+	return gui.AudioLevel{
+		RMS:  math.Sqrt(m.sumSquares/float64(m.samples)) / 32768,
+		Peak: float64(m.peak) / 32768,
+		// a handful of full-scale samples per window means the input is overdriven
+		Clipping: m.clipped > m.samples/1000,
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+func TestLevelMeter(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []int16
+		rms      float64
+		peak     float64
+		clipping bool
+	}{
+		{name: "empty"},
+		{name: "silence", samples: []int16{0, 0, 0, 0}},
+		{name: "constant", samples: []int16{16384, 16384, 16384, 16384}, rms: 0.5, peak: 0.5},
+		{name: "square", samples: []int16{8192, -8192, 8192, -8192}, rms: 0.25, peak: 0.25},
+		{name: "mixed", samples: []int16{0, 3000, -4000, 0}, rms: 2500.0 / 32768, peak: 4000.0 / 32768},
+		{
+			name:     "full scale",
+			samples:  []int16{math.MaxInt16, math.MinInt16},
+			rms:      math.Sqrt((32767.0*32767+32768.0*32768)/2) / 32768,
+			peak:     1,
+			clipping: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pcm []byte
+			for _, sample := range tt.samples {
+				pcm = binary.LittleEndian.AppendUint16(pcm, uint16(sample))
+			}
+
+			// one window holding the whole buffer, written in two reads
+			// that split a sample
+			meter := &levelMeter{windowSamples: len(tt.samples)}
+			var levels []gui.AudioLevel
+			emit := func(level gui.AudioLevel) { levels = append(levels, level) }
+			split := len(pcm) / 2
+			if split%2 == 0 && split > 0 {
+				split--
+			}
+			meter.write(pcm[:split], emit)
+			meter.write(pcm[split:], emit)
+
+			if len(tt.samples) == 0 {
+				if len(levels) != 0 {
+					t.Fatalf("empty buffer gave %d readings, want none", len(levels))
+				}
+				return
+			}
+			if len(levels) != 1 {
+				t.Fatalf("got %d readings, want 1", len(levels))
+			}
+			level := levels[0]
+			if math.Abs(level.RMS-tt.rms) > 1e-9 {
+				t.Errorf("RMS = %v, want %v", level.RMS, tt.rms)
+			}
+			if math.Abs(level.Peak-tt.peak) > 1e-9 {
+				t.Errorf("Peak = %v, want %v", level.Peak, tt.peak)
+			}
+			if level.Clipping != tt.clipping {
+				t.Errorf("Clipping = %v, want %v", level.Clipping, tt.clipping)
+			}
+		})
+	}
+}
@@ -13,9 +13,11 @@ func main() {
 		log.Fatal("Config error:", err)
 	}
 	
-	recorder := &AudioRecorder{}
+	recorder := NewAudioRecorder(config)
 	aiProcessor := NewOpenAIProcessor(config)
+	recovery := NewSessionRecovery(recorder)
+	recorder.SetSegmentHandler(aiProcessor.TranscribeSegment)
 	
-	app := gui.NewApp(recorder, config, aiProcessor, saveSummary)
+	app := gui.NewApp(recorder, config, aiProcessor, recovery, saveSummary)
 	app.Run()
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	markersFile = "markers.txt"
+	// transcript within this many seconds of a marker is quoted with it
+	markerContextSeconds = 20
+)
+
+// markerNote is a marker together with the transcript spoken around it.
+type markerNote struct {
+	marker
+	Excerpt string
+}
+
+// alignMarkers finds the transcript around each marker. Without segment
+// timestamps there is nothing to align to and the excerpts stay empty.
+func alignMarkers(markers []marker, segments []transcriptSegment) []markerNote {
+	timed := false
+	for _, segment := range segments {
+		if segment.End > segment.Start {
+			timed = true
+			break
+		}
+	}
+
+	notes := make([]markerNote, 0, len(markers))
+	for _, m := range markers {
+		note := markerNote{marker: m}
+		if timed {
+			var around []transcriptSegment
+			for _, segment := range segments {
+				if segment.End >= m.AudioOffset-markerContextSeconds && segment.Start <= m.AudioOffset+markerContextSeconds {
+					around = append(around, segment)
+				}
+			}
+			note.Excerpt = segmentsText(around)
+		}
+		notes = append(notes, note)
+	}
+	return notes
+}
+
+// formatMarkers renders markers as text, one per block, for markers.txt and
+// the summary prompt.
+func formatMarkers(notes []markerNote) string {
+	var blocks []string
+	for _, note := range notes {
+		block := "[" + formatOffset(note.AudioOffset) + "]"
+		if note.Label != "" {
+			block += " " + note.Label
+		}
+		if note.Excerpt != "" {
+			block += "\n" + note.Excerpt
+		}
+		blocks = append(blocks, block)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// formatOffset renders a position in the audio as MM:SS, or H:MM:SS past the
+// first hour.
+func formatOffset(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total%3600/60, total%60)
+	}
+	return fmt.Sprintf("%02d:%02d", total/60, total%60)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+const (
+	// levels below this are reported as this, 16-bit audio goes no lower
+	qualityFloorDBFS = -96.0
+	// a stretch of unchanging samples at least this long inside a recording
+	// is a gap in the stream rather than a quiet room, whose noise never
+	// repeats exactly
+	dropoutMinMillis = 50
+
+	// recordings that do worse than these are flagged as likely to hurt
+	// the transcript
+	qualityMaxClippingPercent = 0.1
+	qualityMinPeakDBFS        = -30.0
+	qualityMinSNR             = 10.0
+	qualityMaxSilencePercent  = 95.0
+)
+
+// qualityReport describes the audio of one recording or track: its levels
+// in dBFS, how much of it clipped or was silent, how far speech stood above
+// the noise floor and where the stream dropped out.
+type qualityReport struct {
+	Duration        float64   `json:"duration"`
+	PeakDBFS        float64   `json:"peak_dbfs"`
+	RMSDBFS         float64   `json:"rms_dbfs"`
+	ClippingPercent float64   `json:"clipping_percent"`
+	SNR             float64   `json:"snr_db"`
+	SilencePercent  float64   `json:"silence_percent"`
+	Dropouts        []dropout `json:"dropouts,omitempty"`
+}
+
+// dropout is a gap in the stream, in seconds of the recording.
+type dropout struct {
+	Offset   float64 `json:"offset"`
+	Duration float64 `json:"duration"`
+}
+
+// qualityReportPath names the file the quality report of audioFile is saved
+// in, e.g. track_mic_quality.json for track_mic_compressed.flac.
+func qualityReportPath(audioFile string) string {
+	base := strings.TrimSuffix(filepath.Base(audioFile), filepath.Ext(audioFile))
+	base = strings.TrimSuffix(base, "_compressed") + "_quality.json"
+	return filepath.Join(filepath.Dir(audioFile), base)
+}
+
+// checkQuality saves a quality report next to the 16-bit WAV file wavPath and
+// warns through the status channel when the audio is poor enough to affect
+// transcription.
+func (ar *AudioRecorder) checkQuality(wavPath string) {
+	report, err := analyzeQuality(wavPath)
+	if err != nil {
+		fmt.Printf("Warning: quality analysis failed: %v\n", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(qualityReportPath(wavPath), data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to save quality report: %v\n", err)
+	}
+
+	if problems := report.problems(); len(problems) > 0 {
+		ar.reportStatus(gui.RecorderStatus{
+			Kind:    gui.StatusPoorQuality,
+			Track:   strings.TrimSuffix(filepath.Base(wavPath), ".wav"),
+			Message: strings.Join(problems, "; "),
+		})
+	}
+}
+
+func analyzeQuality(wavPath string) (*qualityReport, error) {
+	file, err := os.Open(wavPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	format, dataSize, err := readWAVFormat(file)
+	if err != nil {
+		return nil, err
+	}
+	if format.BitsPerSample != 16 {
+		return nil, fmt.Errorf("quality analysis needs 16-bit audio")
+	}
+
+	frameSize := format.blockAlign()
+	framesPerEnergy := format.SampleRate * vadFrameMillis / 1000
+	minDropout := int64(format.SampleRate * dropoutMinMillis / 1000)
+	seconds := func(frames int64) float64 {
+		return float64(frames) / float64(format.SampleRate)
+	}
+
+	report := &qualityReport{}
+	var energies []float64
+	var sumSquares, energySum float64
+	var samples, clipped, frames int64
+	peak := 0
+	previous := make([]byte, frameSize)
+	var runStart int64
+
+	reader := io.LimitReader(file, dataSize)
+	buffer := make([]byte, framesPerEnergy*frameSize)
+	for {
+		n, readErr := io.ReadFull(reader, buffer)
+		n -= n % frameSize
+		for i := 0; i < n; i += frameSize {
+			frame := buffer[i : i+frameSize]
+			for ch := 0; ch < format.Channels; ch++ {
+				sample := int(int16(binary.LittleEndian.Uint16(frame[2*ch:])))
+				square := float64(sample * sample)
+				sumSquares += square
+				energySum += square
+				peak = max(peak, sample, -sample)
+				if sample >= math.MaxInt16 || sample <= math.MinInt16 {
+					clipped++
+				}
+				samples++
+			}
+
+			if frames == 0 || string(frame) != string(previous) {
+				// a run touching the start is the device warming up
+				if runStart > 0 && frames-runStart >= minDropout {
+					report.Dropouts = append(report.Dropouts, dropout{Offset: seconds(runStart), Duration: seconds(frames - runStart)})
+				}
+				runStart = frames
+				copy(previous, frame)
+			}
+			frames++
+		}
+		if n > 0 {
+			energies = append(energies, math.Sqrt(energySum/float64(n/2))/32768)
+			energySum = 0
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	report.Duration = seconds(frames)
+	if samples == 0 {
+		report.PeakDBFS, report.RMSDBFS = qualityFloorDBFS, qualityFloorDBFS
+		report.SilencePercent = 100
+		return report, nil
+	}
+	report.PeakDBFS = levelDBFS(float64(peak) / 32768)
+	report.RMSDBFS = levelDBFS(math.Sqrt(sumSquares/float64(samples)) / 32768)
+	report.ClippingPercent = float64(clipped) * 100 / float64(samples)
+
+	threshold, noiseFloor := speechThreshold(energies)
+	var speechSquares float64
+	speechFrames := 0
+	for _, energy := range energies {
+		if energy > threshold {
+			speechSquares += energy * energy
+			speechFrames++
+		}
+	}
+	report.SilencePercent = float64(len(energies)-speechFrames) * 100 / float64(len(energies))
+	if speechFrames > 0 {
+		// a floor of digital silence still has one step of quantization noise
+		noiseFloor = math.Max(noiseFloor, 1.0/32768)
+		report.SNR = 20 * math.Log10(math.Sqrt(speechSquares/float64(speechFrames))/noiseFloor)
+	}
+
+	return report, nil
+}
+
+func levelDBFS(level float64) float64 {
+	if level <= 0 {
+		return qualityFloorDBFS
+	}
+	return math.Max(20*math.Log10(level), qualityFloorDBFS)
+}
+
+// problems lists what about the audio is likely to hurt the transcript.
+func (r *qualityReport) problems() []string {
+	var problems []string
+	if r.ClippingPercent > qualityMaxClippingPercent {
+		problems = append(problems, fmt.Sprintf("%.1f%% of samples clipped, lower the input volume", r.ClippingPercent))
+	}
+	if r.PeakDBFS < qualityMinPeakDBFS {
+		problems = append(problems, fmt.Sprintf("very quiet, peaks at %.0f dBFS", r.PeakDBFS))
+	}
+	if r.SilencePercent > qualityMaxSilencePercent {
+		problems = append(problems, fmt.Sprintf("%.0f%% silence", r.SilencePercent))
+	} else if r.SNR < qualityMinSNR {
+		problems = append(problems, fmt.Sprintf("speech only %.0f dB above background noise", r.SNR))
+	}
+	if len(r.Dropouts) > 0 {
+		var lost float64
+		for _, d := range r.Dropouts {
+			lost += d.Duration
+		}
+		problems = append(problems, fmt.Sprintf("%d dropouts, %.1f s of audio missing", len(r.Dropouts), lost))
+	}
+	return problems
+}
+
+func (r *qualityReport) String() string {
+	text := fmt.Sprintf("peak %.1f dBFS, RMS %.1f dBFS, clipping %.2f%%, SNR %.0f dB, silence %.0f%%, dropouts %d",
+		r.PeakDBFS, r.RMSDBFS, r.ClippingPercent, r.SNR, r.SilencePercent, len(r.Dropouts))
+	for _, d := range r.Dropouts {
+		text += fmt.Sprintf("\n  dropout at %s, %.2f s", formatOffset(d.Offset), d.Duration)
+	}
+	for _, problem := range r.problems() {
+		text += "\n  ⚠ " + problem
+	}
+	return text
+}
+
+// qualitySection formats the quality reports saved in sessionDir for the
+// summary file, or returns "" when there are none.
+func qualitySection(sessionDir string) string {
+	var lines []string
+	for _, name := range []string{recordingTrackName, micTrackName, systemTrackName} {
+		data, err := os.ReadFile(qualityReportPath(filepath.Join(sessionDir, name+".wav")))
+		if err != nil {
+			continue
+		}
+		var report qualityReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			continue
+		}
+		lines = append(lines, name+": "+report.String())
+	}
+	return strings.Join(lines, "\n")
+}
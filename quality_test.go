@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// speechFixture returns seconds of mono 16 kHz audio alternating between
+// 300 ms tone bursts and quiet noise that never repeats a sample.
+func speechFixture(seconds float64) []int16 {
+	random := rand.New(rand.NewSource(1))
+	samples := make([]int16, int(seconds*16000))
+	for i := range samples {
+		value := 100*random.NormFloat64() + 1
+		if i/4800%2 == 0 {
+			value += 10000 * math.Sin(2*math.Pi*440*float64(i)/16000)
+		}
+		samples[i] = int16(value)
+		if i > 0 && samples[i] == samples[i-1] {
+			samples[i]++
+		}
+	}
+	return samples
+}
+
+// analyzeSamples writes interleaved samples to a WAV file in format and
+// returns its quality report.
+func analyzeSamples(t *testing.T, format wavFormat, samples []int16) *qualityReport {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "recording.wav")
+	writer, err := createWAV(path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pcm []byte
+	for _, sample := range samples {
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(sample))
+	}
+	writer.Write(pcm)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := analyzeQuality(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func hasProblem(report *qualityReport, text string) bool {
+	for _, problem := range report.problems() {
+		if strings.Contains(problem, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestQualityClipping(t *testing.T) {
+	format := wavFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}
+	samples := speechFixture(2)
+	// three runs of 20 samples pinned at either end of the range
+	for _, start := range []int{1000, 11000, 20000} {
+		for i := start; i < start+20; i++ {
+			samples[i] = math.MaxInt16
+			if start == 11000 {
+				samples[i] = math.MinInt16
+			}
+		}
+	}
+
+	report := analyzeSamples(t, format, samples)
+	if want := 60 * 100.0 / float64(len(samples)); math.Abs(report.ClippingPercent-want) > 1e-9 {
+		t.Errorf("ClippingPercent = %v, want %v", report.ClippingPercent, want)
+	}
+	if report.PeakDBFS != 0 {
+		t.Errorf("PeakDBFS = %.2f, want 0", report.PeakDBFS)
+	}
+	// runs this short are clipping, not a gap in the stream
+	if len(report.Dropouts) != 0 {
+		t.Errorf("clipped runs reported as dropouts: %v", report.Dropouts)
+	}
+	if !hasProblem(report, "clipped") {
+		t.Errorf("clipping not flagged: %v", report.problems())
+	}
+
+	unclipped := analyzeSamples(t, format, speechFixture(2))
+	if unclipped.ClippingPercent != 0 || len(unclipped.problems()) != 0 {
+		t.Errorf("clean fixture reported as %s", unclipped)
+	}
+}
+
+func TestQualityDropouts(t *testing.T) {
+	for _, channels := range []int{1, 2} {
+		format := wavFormat{SampleRate: 16000, Channels: channels, BitsPerSample: 16}
+		tracks := [][]int16{speechFixture(2)}
+		if channels == 2 {
+			// the second channel plays the fixture backwards
+			second := speechFixture(2)
+			slices.Reverse(second)
+			tracks = append(tracks, second)
+		}
+		freeze := func(track []int16, start, millis int) {
+			for i := start; i < start+millis*16; i++ {
+				track[i] = track[start]
+			}
+		}
+		for _, track := range tracks {
+			// a frozen stretch at the start is the device warming up, one of
+			// 40 ms is too short to count, and ones of 50 and 120 ms are gaps
+			freeze(track, 0, 200)
+			freeze(track, 8000, 40)
+			freeze(track, 16000, dropoutMinMillis)
+			freeze(track, 24000, 120)
+		}
+		// a gap needs every channel to stand still
+		freeze(tracks[0], 28000, 100)
+
+		var samples []int16
+		for i := range tracks[0] {
+			for _, track := range tracks {
+				samples = append(samples, track[i])
+			}
+		}
+
+		report := analyzeSamples(t, format, samples)
+		want := []dropout{{Offset: 1, Duration: 0.05}, {Offset: 1.5, Duration: 0.12}}
+		if channels == 1 {
+			want = append(want, dropout{Offset: 1.75, Duration: 0.1})
+		}
+		if len(report.Dropouts) != len(want) {
+			t.Fatalf("%d channels: dropouts %v, want %v", channels, report.Dropouts, want)
+		}
+		for i, d := range report.Dropouts {
+			if math.Abs(d.Offset-want[i].Offset) > 1e-9 || math.Abs(d.Duration-want[i].Duration) > 1e-9 {
+				t.Errorf("%d channels: dropout %d is %v, want %v", channels, i, d, want[i])
+			}
+		}
+		if !hasProblem(report, fmt.Sprintf("%d dropouts", len(want))) {
+			t.Errorf("%d channels: dropouts not flagged: %v", channels, report.problems())
+		}
+	}
+}
+
+func TestQualityNearSilence(t *testing.T) {
+	format := wavFormat{SampleRate: 16000, Channels: 1, BitsPerSample: 16}
+	random := rand.New(rand.NewSource(1))
+	samples := make([]int16, 32000)
+	for i := range samples {
+		samples[i] = int16(random.Intn(7) - 3)
+	}
+	samples[100] = 3 // peaks are 3 steps whatever the noise drew
+
+	report := analyzeSamples(t, format, samples)
+	if want := 20 * math.Log10(3.0/32768); math.Abs(report.PeakDBFS-want) > 1e-9 {
+		t.Errorf("PeakDBFS = %.2f, want %.2f", report.PeakDBFS, want)
+	}
+	if report.RMSDBFS > report.PeakDBFS || report.RMSDBFS < qualityFloorDBFS {
+		t.Errorf("RMSDBFS = %.2f, want between the floor and the %.2f dBFS peak", report.RMSDBFS, report.PeakDBFS)
+	}
+	if report.SilencePercent != 100 {
+		t.Errorf("SilencePercent = %.1f, want 100", report.SilencePercent)
+	}
+	if report.Duration != 2 {
+		t.Errorf("Duration = %v, want 2", report.Duration)
+	}
+	if !hasProblem(report, "very quiet") || !hasProblem(report, "silence") {
+		t.Errorf("near silence not flagged: %v", report.problems())
+	}
+
+	// digital silence is at the floor, and not one long dropout
+	silent := analyzeSamples(t, format, make([]int16, 16000))
+	if silent.PeakDBFS != qualityFloorDBFS || silent.RMSDBFS != qualityFloorDBFS {
+		t.Errorf("digital silence at peak %.1f, RMS %.1f dBFS, want %.0f", silent.PeakDBFS, silent.RMSDBFS, qualityFloorDBFS)
+	}
+	if len(silent.Dropouts) != 0 {
+		t.Errorf("digital silence reported as dropouts: %v", silent.Dropouts)
+	}
+}
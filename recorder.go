@@ -9,143 +9,761 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/youpy/go-wav"
-)
-
-const (
-	sampleRate      = 44100
-	channels        = 1
-	bitsPerSample   = 16
+	"github.com/vadiminshakov/storyshort/gui"
 )
 
 type AudioRecorder struct {
-	isRecording    bool
-	audioData      []byte
+	config         *Config
+	// mu serializes state transitions and guards the tracks, metadata and
+	// start time; the capture goroutines never take it
+	mu             sync.Mutex
+	state          atomic.Int32
+	paused         atomic.Bool
+	metadata       *sessionMetadata
+	mic            *captureTrack
+	system         *captureTrack
+	segmenter      *segmenter
+	onSegment      func(dir string, segment liveSegment)
+	bytesRecorded  atomic.Int64
+	// session numbers the captures, a new one every time tracks open
+	session        atomic.Int64
+	// format is what the current tracks capture in, fixed when they open
+	format         wavFormat
+	// streamURL stands in for the capture source while RecordStream opens
+	// the tracks
+	streamURL      string
+	levels         chan gui.AudioLevel
 	startTime      time.Time
-	recordingDone  chan struct{}
-	cmd            *exec.Cmd
-	statusUpdate   chan string
+	status         chan gui.RecorderStatus
+}
+
+// captureTrack is one capture source streaming into its own spool file, or
+// into a ring buffer while the recorder is armed.
+type captureTrack struct {
+	name    string
+	primary bool // the recording is lost without this track
+	session int64
+	source  CaptureSource
+	stream  io.ReadCloser
+	mu      sync.Mutex
+	ring    *ringBuffer
+	spool   *wavWriter
+	done    chan struct{}
+	levels  chan gui.AudioLevel
+}
+
+func NewAudioRecorder(config *Config) *AudioRecorder {
+	return &AudioRecorder{config: config, status: make(chan gui.RecorderStatus, 32)}
+}
+
+// Status returns capture problems as they happen, for recordings and for the
+// armed rolling buffer alike. The channel stays open for the recorder's life.
+func (ar *AudioRecorder) Status() <-chan gui.RecorderStatus {
+	return ar.status
+}
+
+// Session identifies the current capture, armed or recording, in the
+// statuses it reports. It changes every time capture starts.
+func (ar *AudioRecorder) Session() int64 {
+	return ar.session.Load()
+}
+
+func (ar *AudioRecorder) reportStatus(status gui.RecorderStatus) {
+	select {
+	case ar.status <- status:
+	default:
+		// nobody is listening, or not fast enough
+	}
 }
 
 func (ar *AudioRecorder) InitializeAudio() error {
-	if isAudioToolAvailable() {
+	if isExternalCaptureSource(ar.config.GetCaptureSource()) || isAudioToolAvailable() {
 		return nil
 	}
 	
 	return installAudioTool()
 }
 
-func (ar *AudioRecorder) GetAudioData() []byte {
-	return ar.audioData
+// Levels returns the input level readings of the current recording. The
+// channel is closed when capture ends.
+func (ar *AudioRecorder) Levels() <-chan gui.AudioLevel {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.levels
+}
+
+// GetAudioSize returns the number of PCM bytes captured so far.
+func (ar *AudioRecorder) GetAudioSize() int64 {
+	return ar.bytesRecorded.Load()
+}
+
+// ListInputDevices returns the inputs offered by the configured capture
+// backend. Sources without devices, like file replay, return none.
+func (ar *AudioRecorder) ListInputDevices() ([]gui.InputDevice, error) {
+	// the format only matters once a source is started
+	source, err := newCaptureSource(ar.config.GetCaptureSource(), "", wavFormat{})
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := source.Devices()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]gui.InputDevice, len(devices))
+	for i, device := range devices {
+		result[i] = gui.InputDevice{ID: device.ID, Name: device.Name}
+	}
+	return result, nil
 }
 
 func (ar *AudioRecorder) StartRecording() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.getState() == stateArmed {
+		return ar.saveBuffer()
+	}
+	return ar.startRecording()
+}
+
+// RecordStream starts a recording of a network stream instead of the
+// configured input. An armed rolling buffer is dropped, as it holds audio
+// from the microphone.
+func (ar *AudioRecorder) RecordStream(url string) error {
+	if !isStreamURL(url) {
+		return fmt.Errorf("%q is not an HTTP, RTSP or RTMP URL", url)
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.getState() == stateArmed {
+		ar.disarm()
+	}
+	ar.streamURL = url
+	defer func() { ar.streamURL = "" }()
+	return ar.startRecording()
+}
+
+func (ar *AudioRecorder) startRecording() error {
+	if state := ar.getState(); state != stateIdle {
+		return fmt.Errorf("cannot start recording, recorder is %s", state)
+	}
+
+	ar.setState(stateStarting)
+	if err := ar.openTracks(0); err != nil {
+		ar.setState(stateIdle)
+		return err
+	}
+	if err := ar.openStreams(); err != nil {
+		ar.mic, ar.system = nil, nil
+		ar.setState(stateIdle)
+		return err
+	}
+
 	ar.startTime = time.Now()
-	ar.isRecording = true
-	ar.recordingDone = make(chan struct{})
-	ar.audioData = make([]byte, 0)
-	ar.statusUpdate = make(chan string, 10)
+	if err := ar.startSpools(); err != nil {
+		ar.closeStreams()
+		ar.mic, ar.system = nil, nil
+		ar.setState(stateIdle)
+		return err
+	}
+
+	ar.paused.Store(false)
+	ar.setState(stateRecording)
 
-	go ar.recordAudio()
+	ar.startCapture()
+	ar.startSegmenter()
 	return nil
 }
 
-func (ar *AudioRecorder) StopRecording() error {
-	ar.isRecording = false
-	if ar.cmd != nil && ar.cmd.Process != nil {
-		ar.cmd.Process.Kill()
+// Arm starts capturing into a ring buffer that holds the last minutes of
+// audio. StartRecording then keeps that audio as the start of the recording.
+func (ar *AudioRecorder) Arm(minutes int) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	switch state := ar.getState(); state {
+	case stateArmed:
+		return nil
+	case stateIdle:
+	default:
+		return fmt.Errorf("cannot arm the rolling buffer, recorder is %s", state)
 	}
-	if ar.recordingDone != nil {
-		<-ar.recordingDone
+	if minutes <= 0 || minutes > maxRollingBufferMinutes {
+		return fmt.Errorf("rolling buffer must be between 1 and %d minutes", maxRollingBufferMinutes)
+	}
+
+	if err := ar.openTracks(minutes); err != nil {
+		return err
 	}
+	if err := ar.openStreams(); err != nil {
+		ar.mic, ar.system = nil, nil
+		return err
+	}
+
+	ar.setState(stateArmed)
+	ar.startCapture()
 	return nil
 }
 
-func (ar *AudioRecorder) recordAudio() {
-	defer close(ar.recordingDone)
+// Disarm stops capturing into the ring buffer and drops the buffered audio.
+func (ar *AudioRecorder) Disarm() {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
 
-	var cmd *exec.Cmd
-	
-	if _, err := exec.LookPath("sox"); err == nil {
-		cmd = exec.Command("sox", "-d", "-t", "raw", "-b", "16", "-e", "signed-integer", "-r", "44100", "-c", "1", "-")
-	} else if _, err := exec.LookPath("rec"); err == nil {
-		cmd = exec.Command("rec", "-t", "raw", "-b", "16", "-e", "signed-integer", "-r", "44100", "-c", "1", "-")
-	} else {
-		log.Println("Warning: sox/rec not found, using ffmpeg fallback")
-		cmd = exec.Command("ffmpeg", "-f", "avfoundation", "-i", ":0", "-ar", "44100", "-ac", "1", "-f", "s16le", "-")
+	if ar.getState() == stateArmed {
+		ar.disarm()
+	}
+}
+
+func (ar *AudioRecorder) disarm() {
+	ar.setState(stateStopping)
+	ar.stopCapture()
+	ar.mic, ar.system = nil, nil
+	ar.setState(stateIdle)
+}
+
+// bufferedDuration is how much audio the armed recorder would keep if the
+// recording started now.
+func (ar *AudioRecorder) bufferedDuration() time.Duration {
+	ar.mic.mu.Lock()
+	defer ar.mic.mu.Unlock()
+	return ar.format.duration(int64(ar.mic.ring.Len()))
+}
+
+// GetStartTime returns when the current recording starts, which for a saved
+// rolling buffer lies before StartRecording was called.
+func (ar *AudioRecorder) GetStartTime() time.Time {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.startTime
+}
+
+// saveBuffer turns the audio buffered while armed into a recording that
+// continues until StopRecording.
+func (ar *AudioRecorder) saveBuffer() error {
+	ar.setState(stateStarting)
+	ar.startTime = time.Now().Add(-ar.bufferedDuration())
+	if err := ar.startSpools(); err != nil {
+		ar.disarm()
+		return err
 	}
 
-	ar.cmd = cmd
-	stdout, err := cmd.StdoutPipe()
+	ar.paused.Store(false)
+	ar.setState(stateRecording)
+
+	ar.startSegmenter()
+	return nil
+}
+
+// openTracks sets up the microphone track and, when enabled, the system audio
+// track, in the configured capture format. With ringMinutes the tracks buffer
+// that much audio in memory until startSpools; otherwise startSpools must be
+// called before capture starts.
+func (ar *AudioRecorder) openTracks(ringMinutes int) error {
+	format, err := captureFormat(ar.config)
 	if err != nil {
-		log.Printf("Failed to create stdout pipe: %v", err)
-		return
+		return err
+	}
+	ar.format = format
+
+	source, err := ar.newSource()
+	if err != nil {
+		return err
+	}
+	name := "microphone"
+	if ar.streamURL != "" {
+		name = "stream"
+	}
+	session := ar.session.Add(1)
+	mic := &captureTrack{name: name, primary: true, session: session, source: source, done: make(chan struct{})}
+
+	// a stream already carries everything that is said
+	var system *captureTrack
+	if ar.config.GetCaptureSystemAudio() && ar.streamURL == "" {
+		loopback, err := newLoopbackSource(ar.config.GetCaptureSource(), ar.config.GetLoopbackDevice(), format)
+		if err != nil {
+			return fmt.Errorf("system audio capture unavailable: %w", err)
+		}
+		system = &captureTrack{name: "system audio", session: session, source: loopback, done: make(chan struct{})}
+	}
+
+	if ringMinutes > 0 {
+		capacity := ringMinutes * 60 * format.byteRate()
+		mic.ring = newRingBuffer(capacity, format.blockAlign())
+		if system != nil {
+			system.ring = newRingBuffer(capacity, format.blockAlign())
+		}
+	}
+
+	// only the microphone is metered, silence on the system track is normal
+	mic.levels = make(chan gui.AudioLevel, levelWindowsPerSecond)
+
+	ar.mic = mic
+	ar.system = system
+	ar.levels = mic.levels
+	return nil
+}
+
+// startSpools opens the spool files of the current tracks, named after
+// ar.startTime, and starts the session metadata next to them.
+func (ar *AudioRecorder) startSpools() error {
+	spoolDir, err := getSpoolDir()
+	if err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	// nothing is counted yet: capture either has not started or still
+	// fills the ring buffers, and from the moment a track's spool starts
+	// store adds to the count concurrently
+	ar.bytesRecorded.Store(0)
+
+	micSpool := newSpoolPath(spoolDir, ar.startTime)
+	if err := ar.mic.startSpool(micSpool, ar.format, &ar.bytesRecorded); err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	if ar.system != nil {
+		if err := ar.system.startSpool(systemSpoolPath(micSpool), ar.format, &ar.bytesRecorded); err != nil {
+			ar.mic.spool.Close()
+			os.Remove(micSpool)
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
 	}
 
-	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to start recording command: %v", err)
-		return
+	ar.metadata = &sessionMetadata{StartTime: ar.startTime}
+	if err := ar.metadata.save(metadataSpoolPath(micSpool)); err != nil {
+		log.Printf("Failed to save session metadata: %v", err)
+	}
+	return nil
+}
+
+// openStreams starts the capture source of every track, so that a missing
+// device or tool fails the start instead of a silent recording.
+func (ar *AudioRecorder) openStreams() error {
+	for _, track := range []*captureTrack{ar.mic, ar.system} {
+		if track == nil {
+			continue
+		}
+
+		if reporter, ok := track.source.(outputReporter); ok {
+			name, session := track.name, track.session
+			reporter.ReportOutput(func(line string) {
+				ar.reportStatus(gui.RecorderStatus{Kind: gui.StatusToolOutput, Session: session, Track: name, Message: line})
+			})
+		}
+
+		log.Printf("Recording %s from %s", track.name, track.source.Name())
+		stream, err := track.source.Start()
+		if err != nil {
+			ar.closeStreams()
+			return fmt.Errorf("failed to start %s capture: %w", track.name, err)
+		}
+		track.stream = stream
+	}
+	return nil
+}
+
+// closeStreams releases the streams of tracks whose capture never started.
+func (ar *AudioRecorder) closeStreams() {
+	for _, track := range []*captureTrack{ar.mic, ar.system} {
+		if track == nil || track.stream == nil {
+			continue
+		}
+		track.source.Stop()
+		track.stream.Close()
+		track.stream = nil
+	}
+}
+
+func (ar *AudioRecorder) startCapture() {
+	go ar.recordAudio(ar.mic)
+	if ar.system != nil {
+		go ar.recordAudio(ar.system)
+	}
+}
+
+func (ar *AudioRecorder) stopCapture() {
+	for _, track := range []*captureTrack{ar.mic, ar.system} {
+		if track == nil {
+			continue
+		}
+		track.source.Stop()
+		<-track.done
+	}
+}
+
+// StopRecording ends the recording; reason is kept in the session metadata.
+// Stopping a recording that has already stopped does nothing.
+func (ar *AudioRecorder) StopRecording(reason string) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	switch state := ar.getState(); state {
+	case stateRecording:
+	case stateStopping, stateStopped, stateIdle:
+		return nil
+	default:
+		return fmt.Errorf("cannot stop recording, recorder is %s", state)
+	}
+
+	if ar.paused.Load() {
+		ar.resume()
+	}
+	ar.setState(stateStopping)
+	defer ar.setState(stateStopped)
+
+	ar.metadata.EndTime = time.Now()
+	ar.metadata.StopReason = reason
+	ar.saveMetadata()
+
+	ar.stopCapture()
+	if ar.segmenter != nil {
+		close(ar.segmenter.stop)
+	}
+	for _, track := range []*captureTrack{ar.mic, ar.system} {
+		if track == nil {
+			continue
+		}
+		if err := track.spool.Close(); err != nil {
+			return fmt.Errorf("failed to finalize recording: %w", err)
+		}
+	}
+	return nil
+}
+
+// Pause stops adding captured audio to the recording. The capture tools keep
+// running so that resuming is instant.
+func (ar *AudioRecorder) Pause() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.getState() != stateRecording {
+		return fmt.Errorf("not recording")
+	}
+	if ar.paused.Load() {
+		return nil
+	}
+
+	ar.paused.Store(true)
+	ar.metadata.Pauses = append(ar.metadata.Pauses, pausePoint{
+		AudioOffset: ar.audioOffset(),
+		PausedAt:    time.Now(),
+	})
+	ar.saveMetadata()
+	return nil
+}
+
+func (ar *AudioRecorder) Resume() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.getState() != stateRecording {
+		return fmt.Errorf("not recording")
+	}
+	if ar.paused.Load() {
+		ar.resume()
+	}
+	return nil
+}
+
+func (ar *AudioRecorder) resume() {
+	ar.metadata.Pauses[len(ar.metadata.Pauses)-1].ResumedAt = time.Now()
+	ar.saveMetadata()
+	ar.paused.Store(false)
+}
+
+// AddMarker flags the current moment of the recording as important. The label
+// may be empty.
+func (ar *AudioRecorder) AddMarker(label string) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.getState() != stateRecording {
+		return fmt.Errorf("not recording")
+	}
+
+	ar.metadata.Markers = append(ar.metadata.Markers, marker{
+		AudioOffset: ar.audioOffset(),
+		MarkedAt:    time.Now(),
+		Label:       strings.TrimSpace(label),
+	})
+	ar.saveMetadata()
+	return nil
+}
+
+// audioOffset is the current position in the recording, in seconds.
+func (ar *AudioRecorder) audioOffset() float64 {
+	ar.mic.mu.Lock()
+	defer ar.mic.mu.Unlock()
+	return ar.format.duration(ar.mic.spool.DataSize()).Seconds()
+}
+
+func (ar *AudioRecorder) saveMetadata() {
+	if err := ar.metadata.save(metadataSpoolPath(ar.mic.spool.Path())); err != nil {
+		log.Printf("Failed to save session metadata: %v", err)
+	}
+}
+
+// startSpool starts writing the track to a spool file at path, beginning
+// with whatever its ring buffer holds, and adds the buffered bytes to
+// recorded.
+func (t *captureTrack) startSpool(path string, format wavFormat, recorded *atomic.Int64) error {
+	spool, err := createWAV(path, format)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ring != nil {
+		n, err := t.ring.WriteTo(spool)
+		if err != nil {
+			spool.Close()
+			os.Remove(path)
+			return err
+		}
+		recorded.Add(n)
+		t.ring = nil
+	}
+	t.spool = spool
+	return nil
+}
+
+// store adds captured audio to the track's ring buffer while the recorder is
+// armed and to its spool file once it records.
+func (ar *AudioRecorder) store(track *captureTrack, pcm []byte) error {
+	track.mu.Lock()
+	defer track.mu.Unlock()
+
+	if track.ring != nil {
+		track.ring.Write(pcm)
+		return nil
+	}
+	if ar.paused.Load() {
+		return nil
+	}
+	if _, err := track.spool.Write(pcm); err != nil {
+		return err
+	}
+	ar.bytesRecorded.Add(int64(len(pcm)))
+	return nil
+}
+
+// newSource builds the capture source for the saved input device, falling back
+// to the default input when that device is no longer present.
+func (ar *AudioRecorder) newSource() (CaptureSource, error) {
+	if ar.streamURL != "" {
+		return newStreamSource(ar.streamURL, ar.format), nil
+	}
+
+	spec := ar.config.GetCaptureSource()
+	device := ar.config.GetInputDevice()
+
+	source, err := newCaptureSource(spec, device, ar.format)
+	if err != nil || device == "" {
+		return source, err
+	}
+
+	devices, err := source.Devices()
+	if err != nil {
+		// without a device list there is nothing to check against
+		return source, nil
+	}
+	for _, available := range devices {
+		if available.ID == device {
+			return source, nil
+		}
+	}
+
+	log.Printf("Input device %q not found, using default input", device)
+	return newCaptureSource(spec, "", ar.format)
+}
+
+func (ar *AudioRecorder) recordAudio(track *captureTrack) {
+	defer close(track.done)
+	if track.levels != nil {
+		defer close(track.levels)
+	}
+
+	stream := track.stream
+	defer stream.Close()
+
+	// capture that ends while still wanted means the tool or device failed
+	fail := func(kind gui.RecorderStatusKind, err error) {
+		if !ar.capturing() {
+			return
+		}
+		log.Printf("Capture of %s failed: %v", track.name, err)
+		ar.reportStatus(gui.RecorderStatus{
+			Kind:    kind,
+			Session: track.session,
+			Track:   track.name,
+			Message: err.Error(),
+			Fatal:   track.primary,
+		})
+	}
+
+	meter := newLevelMeter(ar.format)
+	publish := func(level gui.AudioLevel) {
+		select {
+		case track.levels <- level:
+		default:
+			// the GUI is behind, drop the reading rather than stall capture
+		}
 	}
 
 	buffer := make([]byte, 4096)
-	for ar.isRecording {
-		n, err := stdout.Read(buffer)
+	for ar.capturing() {
+		n, err := stream.Read(buffer)
 		if err != nil {
-			if err != io.EOF {
-				log.Printf("Error reading audio data: %v", err)
+			if err == io.EOF {
+				err = fmt.Errorf("%s stopped sending audio", track.source.Name())
 			}
+			fail(gui.StatusCaptureStopped, err)
 			break
 		}
+		if n > 0 && track.levels != nil {
+			meter.write(buffer[:n], publish)
+		}
 		if n > 0 {
-			ar.audioData = append(ar.audioData, buffer[:n]...)
+			if err := ar.store(track, buffer[:n]); err != nil {
+				log.Printf("Error writing audio data: %v", err)
+				fail(gui.StatusWriteFailed, err)
+				break
+			}
 		}
 	}
-
-	stdout.Close()
-	cmd.Wait()
 }
 
+// SaveAudio moves a stopped recording into sessionDir and returns the file to
+// transcribe. The recorder is idle again as soon as SaveAudio has taken the
+// recording over, before any segment still being transcribed is waited for.
 func (ar *AudioRecorder) SaveAudio(sessionDir string) (string, error) {
-	if len(ar.audioData) == 0 {
+	ar.mu.Lock()
+	if state := ar.getState(); state != stateStopped {
+		ar.mu.Unlock()
+		return "", fmt.Errorf("no recording to save, recorder is %s", state)
+	}
+	mic, system, segments := ar.mic, ar.system, ar.segmenter
+	ar.mic, ar.system, ar.segmenter = nil, nil, nil
+	// the recording's files are its own from here on, so the next one can
+	// start while this one waits for a segment upload and is saved
+	ar.setState(stateIdle)
+	ar.mu.Unlock()
+
+	if segments != nil {
+		// a segment still being transcribed is waited for, ProcessAudio would
+		// only upload it again
+		<-segments.done
+		if mic == nil || mic.spool.DataSize() == 0 {
+			os.RemoveAll(segments.dir)
+		} else {
+			systemSpool := ""
+			if system != nil && system.spool.DataSize() > 0 {
+				systemSpool = system.spool.Path()
+			}
+			if err := ar.finishSegments(segments.dir, sessionDir, mic.spool.Path(), systemSpool); err != nil {
+				fmt.Printf("Warning: failed to finish live segments, transcribing after stop: %v\n", err)
+				os.RemoveAll(segments.dir)
+				os.RemoveAll(filepath.Join(sessionDir, segmentsDirName))
+			}
+		}
+	}
+
+	if mic != nil {
+		metadataSpool := metadataSpoolPath(mic.spool.Path())
+		if mic.spool.DataSize() == 0 {
+			os.Remove(metadataSpool)
+		} else if err := moveFile(metadataSpool, filepath.Join(sessionDir, sessionMetadataFile)); err != nil {
+			fmt.Printf("Warning: failed to save session metadata: %v\n", err)
+		}
+	}
+
+	if system != nil && system.spool.DataSize() == 0 {
+		os.Remove(system.spool.Path())
+		system = nil
+	}
+
+	if mic == nil || mic.spool.DataSize() == 0 {
+		if mic != nil {
+			os.Remove(mic.spool.Path())
+		}
+		if system != nil {
+			os.Remove(system.spool.Path())
+		}
 		return "", fmt.Errorf("no_audio_data")
 	}
 
+	if system != nil {
+		mixPath, err := ar.finishTracks(sessionDir, mic.spool.Path(), system.spool.Path())
+		if err != nil {
+			return "", err
+		}
+		return ar.compressOrKeep(mixPath), nil
+	}
+
 	fileName := "recording.wav"
 	filePath := filepath.Join(sessionDir, fileName)
 
-	file, err := os.Create(filePath)
-	if err != nil {
+	if err := moveFile(mic.spool.Path(), filePath); err != nil {
 		return "", err
 	}
-	defer file.Close()
 
-	writer := wav.NewWriter(file, uint32(len(ar.audioData)/2), channels, sampleRate, bitsPerSample)
-	
-	samples := make([]wav.Sample, len(ar.audioData)/2)
-	for i := 0; i < len(samples); i++ {
-		if i*2+1 < len(ar.audioData) {
-			sample := int16(ar.audioData[i*2]) | int16(ar.audioData[i*2+1])<<8
-			samples[i].Values[0] = int(sample)
+	return ar.prepareTrack(sessionDir, recordingTrackName, filePath), nil
+}
+
+// prepareForUpload checks the quality of a finished recording that is going
+// to be transcribed and compresses it. With any cleanup stage on, a cleaned
+// up copy is made first, and with silence trimming on a trimmed copy of that;
+// both are compressed alongside the recording and the transcriber prefers them.
+func (ar *AudioRecorder) prepareForUpload(wavPath string) string {
+	ar.checkQuality(wavPath)
+
+	uploadPath := wavPath
+	if stages := cleanupStagesFor(ar.config); stages.any() {
+		cleanPath, err := cleanAudio(wavPath, stages)
+		if err != nil {
+			fmt.Printf("Warning: audio cleanup failed: %v\n", err)
+		} else {
+			uploadPath = cleanPath
 		}
 	}
 
-	if err := writer.WriteSamples(samples); err != nil {
-		return "", err
+	if ar.config.GetTrimSilence() {
+		speechPath, err := trimSilence(uploadPath, speechFileBase(wavPath))
+		if err != nil {
+			fmt.Printf("Warning: silence trimming failed: %v\n", err)
+		} else if speechPath != "" {
+			ar.compressOrKeep(speechPath)
+		}
 	}
 
-	compressedPath, err := ar.compressAudio(filePath)
-	if err != nil {
-		fmt.Printf("Warning: compression failed, using original file: %v\n", err)
-		return filePath, nil
+	if uploadPath != wavPath {
+		ar.compressOrKeep(uploadPath)
 	}
+	return ar.compressOrKeep(wavPath)
+}
 
-	return compressedPath, nil
+// compressOrKeep compresses wavPath and returns the compressed file, or the
+// WAV file itself when compression isn't possible.
+func (ar *AudioRecorder) compressOrKeep(wavPath string) string {
+	compressedPath, err := ar.compressAudio(wavPath)
+	if err != nil {
+		fmt.Printf("Warning: compression of %s failed, using original file: %v\n", filepath.Base(wavPath), err)
+		return wavPath
+	}
+	return compressedPath
 }
 
 func isAudioToolAvailable() bool {
-	tools := []string{"sox", "rec", "ffmpeg"}
+	tools := []string{"sox", "rec", "parec", "ffmpeg"}
 	for _, tool := range tools {
 		if _, err := exec.LookPath(tool); err == nil {
 			return true
@@ -229,21 +847,16 @@ func isBrewInstalled() bool {
 }
 
 
+// compressAudio encodes a WAV file for upload with encodeSpeech and removes
+// the original once that succeeded. An original whose encoding is still too
+// large to upload at once is kept, to cut chunks from without ffmpeg; it goes
+// when the session's work directory does.
 func (ar *AudioRecorder) compressAudio(inputPath string) (string, error) {
 	dir := filepath.Dir(inputPath)
 	baseName := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
-	compressedPath := filepath.Join(dir, baseName+"_compressed.mp3")
+	compressedPath := filepath.Join(dir, baseName+compressedSuffix)
 
-	var cmd *exec.Cmd
-	if _, err := exec.LookPath("ffmpeg"); err == nil {
-		cmd = exec.Command("ffmpeg", "-i", inputPath, "-codec:a", "libmp3lame", "-b:a", "64k", "-ac", "1", "-ar", "16000", "-y", compressedPath)
-	} else if _, err := exec.LookPath("sox"); err == nil {
-		cmd = exec.Command("sox", inputPath, "-C", "64", "-r", "16000", "-c", "1", compressedPath)
-	} else {
-		return "", fmt.Errorf("no compression tool available (ffmpeg or sox required)")
-	}
-
-	if err := cmd.Run(); err != nil {
+	if err := encodeSpeech(inputPath, compressedPath); err != nil {
 		return "", fmt.Errorf("compression failed: %w", err)
 	}
 
@@ -263,7 +876,9 @@ func (ar *AudioRecorder) compressAudio(inputPath string) (string, error) {
 		float64(compressedInfo.Size())/1024/1024, 
 		compressionRatio)
 
-	os.Remove(inputPath)
+	if compressedInfo.Size() <= maxUploadSize {
+		os.Remove(inputPath)
+	}
 	return compressedPath, nil
 }
 
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+// writeTestWAV writes seconds of a 440 Hz tone in format to dir and returns
+// the file and its PCM data.
+func writeTestWAV(t *testing.T, dir string, format wavFormat, seconds float64) (string, []byte) {
+	t.Helper()
+
+	pcm := testTone(format, seconds)
+	path := filepath.Join(dir, "input.wav")
+	writer, err := createWAV(path, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(pcm); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, pcm
+}
+
+func testTone(format wavFormat, seconds float64) []byte {
+	frames := int(seconds * float64(format.SampleRate))
+	pcm := make([]byte, 0, frames*format.blockAlign())
+	for i := 0; i < frames; i++ {
+		sample := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/float64(format.SampleRate)))
+		for ch := 0; ch < format.Channels; ch++ {
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(sample))
+		}
+	}
+	return pcm
+}
+
+// newTestRecorder returns a recorder capturing from source in the speech
+// format, with its spool directory inside the test's temporary directory.
+func newTestRecorder(t *testing.T, source string) *AudioRecorder {
+	t.Helper()
+	t.Setenv("TMPDIR", t.TempDir())
+	return NewAudioRecorder(&Config{CaptureSource: source, CaptureFormat: speechFormat})
+}
+
+// waitForCaptureEnd waits until the recorder reports that its source ran out
+// of audio and returns that report.
+func waitForCaptureEnd(t *testing.T, ar *AudioRecorder) gui.RecorderStatus {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case status := <-ar.Status():
+			if status.Kind == gui.StatusCaptureStopped {
+				return status
+			}
+		case <-timeout:
+			t.Fatal("capture did not end")
+		}
+	}
+}
+
+// checkSpool verifies that the finished spool file at path is a WAV file in
+// format holding exactly pcm.
+func checkSpool(t *testing.T, path string, format wavFormat, pcm []byte) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	spoolFormat, dataSize, err := readWAVFormat(file)
+	if err != nil {
+		t.Fatalf("spool header: %v", err)
+	}
+	if spoolFormat != format {
+		t.Errorf("spool format = %s, want %s", spoolFormat, format)
+	}
+	if dataSize != int64(len(pcm)) {
+		t.Errorf("spool data size = %d, want %d", dataSize, len(pcm))
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, pcm) {
+		t.Errorf("spool holds %d bytes that differ from the %d captured", len(data), len(pcm))
+	}
+}
+
+// recordAndSave stops a recording whose source has ended, checks its spool
+// and saves it to a new session directory.
+func recordAndSave(t *testing.T, ar *AudioRecorder, pcm []byte) {
+	t.Helper()
+
+	spool := ar.mic.spool.Path()
+	if err := ar.StopRecording("test"); err != nil {
+		t.Fatal(err)
+	}
+	checkSpool(t, spool, captureFormatPresets[speechFormat], pcm)
+	if size := ar.GetAudioSize(); size != int64(len(pcm)) {
+		t.Errorf("GetAudioSize() = %d, want %d", size, len(pcm))
+	}
+
+	sessionDir := t.TempDir()
+	audioFile, err := ar.SaveAudio(sessionDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(audioFile) != sessionDir {
+		t.Errorf("audio saved to %s, want it in %s", audioFile, sessionDir)
+	}
+	if _, err := os.Stat(audioFile); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(sessionDir, sessionMetadataFile)); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool file left behind: %v", err)
+	}
+	if state := ar.getState(); state != stateIdle {
+		t.Errorf("recorder is %s after SaveAudio, want idle", state)
+	}
+}
+
+func TestRecordFromFileSource(t *testing.T) {
+	path, pcm := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0.5)
+	ar := newTestRecorder(t, "file:"+path)
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	waitForCaptureEnd(t, ar)
+	recordAndSave(t, ar, pcm)
+}
+
+// pipeStdin replaces stdin for the rest of the test with a pipe and returns
+// its write end.
+func pipeStdin(t *testing.T) *os.File {
+	t.Helper()
+
+	stdin, feed, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := os.Stdin
+	os.Stdin = stdin
+	// the pump of an earlier test has seen its stdin end
+	sharedStdin = newStdinPump()
+	t.Cleanup(func() {
+		os.Stdin = original
+		stdin.Close()
+		feed.Close()
+	})
+	return feed
+}
+
+func TestStatusNamesItsCapture(t *testing.T) {
+	path, pcm := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0.2)
+	ar := newTestRecorder(t, "file:"+path)
+
+	var sessions []int64
+	for range 2 {
+		if err := ar.StartRecording(); err != nil {
+			t.Fatal(err)
+		}
+		status := waitForCaptureEnd(t, ar)
+		if status.Session != ar.Session() {
+			t.Errorf("status names capture %d, the current one is %d", status.Session, ar.Session())
+		}
+		sessions = append(sessions, status.Session)
+		recordAndSave(t, ar, pcm)
+	}
+	if sessions[0] == sessions[1] {
+		t.Errorf("both recordings report as capture %d", sessions[0])
+	}
+}
+
+func TestRecordFromStdin(t *testing.T) {
+	pcm := testTone(captureFormatPresets[speechFormat], 0.5)
+
+	feed := pipeStdin(t)
+
+	// two recordings in a row read the same stdin, each getting the bytes
+	// piped in while it runs
+	half := len(pcm) / 2
+	half -= half % 2
+	first, second := pcm[:half], pcm[half:]
+	ar := newTestRecorder(t, "stdin")
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := feed.Write(first); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for ar.GetAudioSize() < int64(len(first)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("recorded %d bytes, want %d", ar.GetAudioSize(), len(first))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	recordAndSave(t, ar, first)
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	// written in two parts, as a pipe delivers them
+	quarter := len(second) / 2
+	quarter -= quarter % 2
+	for _, part := range [][]byte{second[:quarter], second[quarter:]} {
+		if _, err := feed.Write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	feed.Close()
+
+	waitForCaptureEnd(t, ar)
+	recordAndSave(t, ar, second)
+}
+
+func TestFileSourceRejectsOtherFormat(t *testing.T) {
+	path, _ := writeTestWAV(t, t.TempDir(), captureFormatPresets[standardFormat], 0.1)
+	ar := newTestRecorder(t, "file:"+path)
+
+	if err := ar.StartRecording(); err == nil {
+		ar.StopRecording("test")
+		t.Fatal("recording a 44.1 kHz file in the 16 kHz format succeeded")
+	}
+	if state := ar.getState(); state != stateIdle {
+		t.Errorf("recorder is %s after a failed start, want idle", state)
+	}
+}
+
+func TestStartWhileSavingWaitsForSegment(t *testing.T) {
+	path, pcm := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0.2)
+	ar := newTestRecorder(t, "file:"+path)
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	waitForCaptureEnd(t, ar)
+	if err := ar.StopRecording("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a live segment upload still running when the recording is saved
+	upload := &segmenter{dir: t.TempDir(), done: make(chan struct{})}
+	ar.segmenter = upload
+	saved := make(chan error, 1)
+	go func() {
+		_, err := ar.SaveAudio(t.TempDir())
+		saved <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ar.getState() != stateIdle {
+		if time.Now().After(deadline) {
+			t.Fatalf("recorder is %s while the upload runs, want idle", ar.getState())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ar.StartRecording(); err != nil {
+		t.Fatalf("next recording did not start during the upload: %v", err)
+	}
+
+	close(upload.done)
+	if err := <-saved; err != nil {
+		t.Fatal(err)
+	}
+
+	waitForCaptureEnd(t, ar)
+	recordAndSave(t, ar, pcm)
+}
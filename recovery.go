@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+const sessionStateFile = "state.json"
+
+// sessionState is kept in the work directory of every recording so that an
+// interrupted run can pick up after its last completed step.
+type sessionState struct {
+	StartTime  time.Time `json:"start_time"`
+	AudioFile  string    `json:"audio_file,omitempty"`
+	Title      string    `json:"title,omitempty"`
+	Summary    string    `json:"summary,omitempty"`
+	SessionDir string    `json:"session_dir,omitempty"`
+}
+
+func loadSessionState(workDir string) (*sessionState, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, sessionStateFile))
+	if os.IsNotExist(err) {
+		return &sessionState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *sessionState) save(workDir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workDir, sessionStateFile), data, 0600)
+}
+
+func getWorkRoot() (string, error) {
+	workRoot := filepath.Join(os.TempDir(), "temp_recording")
+	if err := os.MkdirAll(workRoot, 0755); err != nil {
+		return "", err
+	}
+	return workRoot, nil
+}
+
+type SessionRecovery struct {
+	recorder *AudioRecorder
+}
+
+func NewSessionRecovery(recorder *AudioRecorder) *SessionRecovery {
+	return &SessionRecovery{recorder: recorder}
+}
+
+// NewWorkDir creates the temporary directory a recording is processed in.
+func (r *SessionRecovery) NewWorkDir(startTime time.Time) (string, error) {
+	workRoot, err := getWorkRoot()
+	if err != nil {
+		return "", err
+	}
+
+	// numbered like spool files when another recording started that second
+	name := startTime.Format("2006-01-02_15-04-05")
+	workDir := filepath.Join(workRoot, name)
+	for n := 2; fileExists(workDir); n++ {
+		workDir = filepath.Join(workRoot, fmt.Sprintf("%s_%d", name, n))
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", err
+	}
+
+	state := &sessionState{StartTime: startTime}
+	if err := state.save(workDir); err != nil {
+		return "", err
+	}
+
+	return workDir, nil
+}
+
+// FindPendingSessions lists spool files left by a recording that never stopped
+// and work directories whose processing never finished.
+func (r *SessionRecovery) FindPendingSessions() ([]gui.PendingSession, error) {
+	var sessions []gui.PendingSession
+
+	spoolDir, err := getSpoolDir()
+	if err != nil {
+		return nil, err
+	}
+
+	spoolFiles, err := filepath.Glob(filepath.Join(spoolDir, "recording_*.wav"))
+	if err != nil {
+		return nil, err
+	}
+	for _, spoolFile := range spoolFiles {
+		// system audio spool files are recovered together with their microphone track
+		if strings.HasSuffix(spoolFile, "_system.wav") {
+			continue
+		}
+
+		startTime, err := parseSpoolStartTime(spoolFile)
+		if err != nil {
+			fmt.Printf("Warning: skipping spool file %s: %v\n", spoolFile, err)
+			continue
+		}
+
+		info, err := os.Stat(spoolFile)
+		if err != nil || info.Size() <= wavHeaderSize {
+			os.Remove(spoolFile)
+			continue
+		}
+
+		sessions = append(sessions, gui.PendingSession{
+			Path:      spoolFile,
+			StartTime: startTime,
+			Stage:     "Recording interrupted",
+		})
+	}
+
+	workRoot, err := getWorkRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(workRoot)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		workDir := filepath.Join(workRoot, entry.Name())
+		state, err := loadSessionState(workDir)
+		if err != nil {
+			fmt.Printf("Warning: skipping work directory %s: %v\n", workDir, err)
+			continue
+		}
+
+		stage := workDirStage(workDir, state)
+		if stage == "" {
+			// the recording never made it out of the spool directory
+			os.RemoveAll(workDir)
+			continue
+		}
+
+		sessions = append(sessions, gui.PendingSession{
+			Path:      workDir,
+			StartTime: state.StartTime,
+			Stage:     stage,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartTime.Before(sessions[j].StartTime)
+	})
+
+	return sessions, nil
+}
+
+// PrepareSession brings a pending session to the point where ProcessAudio can
+// continue it and returns the audio file to pass along.
+func (r *SessionRecovery) PrepareSession(session gui.PendingSession) (string, error) {
+	info, err := os.Stat(session.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		return r.recoverSpoolFile(session)
+	}
+
+	state, err := loadSessionState(session.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load session state: %w", err)
+	}
+
+	// once the audio has been handed to ProcessAudio its name is recorded,
+	// even if the file itself has already moved into the session directory
+	if state.AudioFile != "" {
+		return filepath.Join(session.Path, state.AudioFile), nil
+	}
+
+	// both tracks are still uncompressed when mixing did not finish
+	if fileExists(filepath.Join(session.Path, micTrackName+".wav")) && fileExists(filepath.Join(session.Path, systemTrackName+".wav")) {
+		os.Remove(filepath.Join(session.Path, "recording"+compressedSuffix))
+		mixPath, err := r.recorder.mixTracks(session.Path)
+		if err != nil {
+			return "", err
+		}
+		return r.recorder.compressOrKeep(mixPath), nil
+	}
+
+	wavPath := filepath.Join(session.Path, "recording.wav")
+	compressedPath := filepath.Join(session.Path, "recording"+compressedSuffix)
+	if _, err := os.Stat(wavPath); err == nil {
+		// the original is only removed after compression succeeds
+		os.Remove(compressedPath)
+		if findTrack(session.Path, micTrackName) != "" {
+			return r.recorder.compressOrKeep(wavPath), nil
+		}
+		return r.recorder.prepareTrack(session.Path, recordingTrackName, wavPath), nil
+	}
+	if _, err := os.Stat(compressedPath); err == nil {
+		return compressedPath, nil
+	}
+
+	return "", fmt.Errorf("no audio found in %s", session.Path)
+}
+
+func (r *SessionRecovery) DiscardSession(session gui.PendingSession) error {
+	if strings.HasSuffix(session.Path, ".wav") {
+		os.Remove(systemSpoolPath(session.Path))
+		os.Remove(metadataSpoolPath(session.Path))
+		os.RemoveAll(segmentsSpoolDir(session.Path))
+	}
+	return os.RemoveAll(session.Path)
+}
+
+func (r *SessionRecovery) recoverSpoolFile(session gui.PendingSession) (string, error) {
+	if _, err := repairWAVHeader(session.Path); err != nil {
+		return "", fmt.Errorf("failed to repair recording: %w", err)
+	}
+
+	workDir, err := r.NewWorkDir(session.StartTime)
+	if err != nil {
+		return "", fmt.Errorf("failed to create work directory: %w", err)
+	}
+
+	metadataSpool := metadataSpoolPath(session.Path)
+	if metadata, err := loadSessionMetadata(metadataSpool); err == nil {
+		if metadata.StopReason == "" {
+			metadata.StopReason = "Recording interrupted"
+		}
+		if err := metadata.save(filepath.Join(workDir, sessionMetadataFile)); err != nil {
+			fmt.Printf("Warning: failed to recover session metadata: %v\n", err)
+		}
+		os.Remove(metadataSpool)
+	}
+
+	systemSpool := systemSpoolPath(session.Path)
+	if _, err := repairWAVHeader(systemSpool); err != nil {
+		systemSpool = ""
+	}
+
+	if segmentsDir := segmentsSpoolDir(session.Path); fileExists(segmentsDir) {
+		if err := r.recorder.finishSegments(segmentsDir, workDir, session.Path, systemSpool); err != nil {
+			fmt.Printf("Warning: failed to recover live segments: %v\n", err)
+			os.RemoveAll(segmentsDir)
+			os.RemoveAll(filepath.Join(workDir, segmentsDirName))
+		}
+	}
+
+	if systemSpool != "" {
+		mixPath, err := r.recorder.finishTracks(workDir, session.Path, systemSpool)
+		if err != nil {
+			return "", fmt.Errorf("failed to recover tracks: %w", err)
+		}
+		return r.recorder.compressOrKeep(mixPath), nil
+	}
+
+	wavPath := filepath.Join(workDir, "recording.wav")
+	if err := moveFile(session.Path, wavPath); err != nil {
+		return "", fmt.Errorf("failed to move recording: %w", err)
+	}
+
+	return r.recorder.prepareTrack(workDir, recordingTrackName, wavPath), nil
+}
+
+func workDirStage(workDir string, state *sessionState) string {
+	switch {
+	case state.SessionDir != "":
+		return "Summary ready, not saved"
+	case state.Title != "":
+		return "Summarized"
+	}
+
+	if _, err := os.Stat(filepath.Join(workDir, "transcript.txt")); err == nil {
+		return "Transcribed"
+	}
+
+	for _, name := range []string{state.AudioFile, "recording.wav", "recording" + compressedSuffix} {
+		if name == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(workDir, name)); err == nil {
+			return "Audio saved, not transcribed"
+		}
+	}
+
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func parseSpoolStartTime(spoolFile string) (time.Time, error) {
+	name := strings.TrimSuffix(filepath.Base(spoolFile), ".wav")
+	name = strings.TrimPrefix(name, "recording_")
+	// numbered names carry the same time, see newSpoolPath
+	const layout = "2006-01-02_15-04-05"
+	if len(name) > len(layout) && name[len(layout)] == '_' {
+		name = name[:len(layout)]
+	}
+	return time.ParseInLocation(layout, name, time.Local)
+}
@@ -0,0 +1,76 @@
+package main
+
+import "io"
+
+// maxRollingBufferMinutes bounds the memory an armed recorder holds, about
+// 5 MB per minute and track in the standard capture format.
+const maxRollingBufferMinutes = 30
+
+// ringBuffer keeps the most recent bytes written to it, up to a fixed size.
+// Writes never block or grow it; the oldest audio is overwritten instead.
+type ringBuffer struct {
+	data    []byte
+	start   int
+	size    int
+	written int64
+	frame   int
+}
+
+// newRingBuffer makes a buffer of capacity bytes for a stream of frame-sized
+// samples, so that what it hands back always starts on a sample boundary.
+func newRingBuffer(capacity, frame int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, capacity-capacity%frame), frame: frame}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	r.written += int64(n)
+	if n >= len(r.data) {
+		copy(r.data, p[n-len(r.data):])
+		r.start, r.size = 0, len(r.data)
+		return n, nil
+	}
+
+	end := (r.start + r.size) % len(r.data)
+	copied := copy(r.data[end:], p)
+	copy(r.data, p[copied:])
+
+	r.size += n
+	if overflow := r.size - len(r.data); overflow > 0 {
+		r.start = (r.start + overflow) % len(r.data)
+		r.size = len(r.data)
+	}
+	return n, nil
+}
+
+// Len returns how many whole-sample bytes the buffer currently holds.
+func (r *ringBuffer) Len() int {
+	return r.size - r.partialFrame()
+}
+
+// partialFrame is the number of leading bytes that belong to a sample whose
+// start has already been overwritten.
+func (r *ringBuffer) partialFrame() int {
+	offset := int((r.written - int64(r.size)) % int64(r.frame))
+	return (r.frame - offset) % r.frame
+}
+
+// WriteTo writes the buffered samples to w, oldest first.
+func (r *ringBuffer) WriteTo(w io.Writer) (int64, error) {
+	skip := r.partialFrame()
+	start := (r.start + skip) % len(r.data)
+	size := r.size - skip
+
+	end := start + size
+	if end <= len(r.data) {
+		n, err := w.Write(r.data[start:end])
+		return int64(n), err
+	}
+
+	n, err := w.Write(r.data[start:])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(r.data[:end-len(r.data)])
+	return int64(n + m), err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sequence returns n bytes counting up from start, so that each byte shows
+// where in the stream it came from.
+func sequence(start, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(start + i)
+	}
+	return data
+}
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		frame    int
+		writes   []int
+		want     []byte
+	}{
+		{name: "empty", capacity: 8, frame: 2, want: []byte{}},
+		{name: "below capacity", capacity: 8, frame: 2, writes: []int{2, 4}, want: sequence(0, 6)},
+		{name: "exactly full", capacity: 8, frame: 2, writes: []int{8}, want: sequence(0, 8)},
+		{name: "full in parts", capacity: 8, frame: 2, writes: []int{6, 2}, want: sequence(0, 8)},
+		{name: "full twice", capacity: 8, frame: 2, writes: []int{8, 8}, want: sequence(8, 8)},
+		{name: "wraps around", capacity: 8, frame: 2, writes: []int{6, 4}, want: sequence(2, 8)},
+		{name: "wraps repeatedly", capacity: 8, frame: 2, writes: []int{6, 6, 6, 6}, want: sequence(16, 8)},
+		{name: "one byte past full", capacity: 8, frame: 1, writes: []int{8, 1}, want: sequence(1, 8)},
+		{name: "write larger than buffer", capacity: 8, frame: 2, writes: []int{3, 21}, want: sequence(16, 8)},
+		{name: "capacity rounded to frames", capacity: 10, frame: 4, writes: []int{12}, want: sequence(4, 8)},
+		// the oldest sample lost its first bytes, so it is not handed back
+		{name: "overwritten sample start", capacity: 8, frame: 4, writes: []int{3, 8}, want: sequence(4, 7)},
+		{name: "sample split by wraparound", capacity: 8, frame: 4, writes: []int{6, 6}, want: sequence(4, 8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newRingBuffer(tt.capacity, tt.frame)
+			written := 0
+			for _, n := range tt.writes {
+				if got, err := ring.Write(sequence(written, n)); got != n || err != nil {
+					t.Fatalf("Write(%d bytes) = %d, %v", n, got, err)
+				}
+				written += n
+			}
+
+			if got := ring.Len(); got != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", got, len(tt.want))
+			}
+			var out bytes.Buffer
+			n, err := ring.WriteTo(&out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(tt.want)) {
+				t.Errorf("WriteTo wrote %d bytes, want %d", n, len(tt.want))
+			}
+			if !bytes.Equal(out.Bytes(), tt.want) {
+				t.Errorf("buffer holds %v, want %v", out.Bytes(), tt.want)
+			}
+		})
+	}
+}
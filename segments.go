@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// a recording in progress is cut into segments this long, which are
+// transcribed while recording goes on
+var segmentInterval = chunkDurationMinutes * time.Minute
+
+const (
+	segmentsDirName  = "segments"
+	segmentsManifest = "segments.json"
+	// the track name of a recording without system audio
+	recordingTrackName = "recording"
+	// segments cut while the handler is still busy with earlier ones wait
+	// here; beyond that they are transcribed after stop
+	segmentQueueSize = 16
+)
+
+// liveSegment is a stretch of one track cut off while recording went on.
+// Start and End are positions in the track, in seconds.
+type liveSegment struct {
+	Track string  `json:"track"`
+	File  string  `json:"file"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// checkpointName is the file the segment's transcript is stored in once it
+// has been transcribed.
+func (s liveSegment) checkpointName() string {
+	base := strings.TrimSuffix(s.File, filepath.Ext(s.File))
+	return strings.TrimSuffix(base, "_compressed") + ".json"
+}
+
+// segmenter cuts the spool files of a recording into segments every
+// segmentInterval until stop is closed, and hands them to the segment handler
+// through queue so that cutting never waits for an upload. done is closed
+// once the handler is through with the last segment.
+type segmenter struct {
+	dir    string
+	tracks map[string]*captureTrack
+	queue  chan liveSegment
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// segmentsSpoolDir names the directory segments are cut into next to the
+// microphone spool file until the recording is saved.
+func segmentsSpoolDir(micSpool string) string {
+	return strings.TrimSuffix(micSpool, ".wav") + "_segments"
+}
+
+// SetSegmentHandler registers a function called, in the background, with
+// every segment cut while recording.
+func (ar *AudioRecorder) SetSegmentHandler(handler func(dir string, segment liveSegment)) {
+	ar.onSegment = handler
+}
+
+func (ar *AudioRecorder) startSegmenter() {
+	s := &segmenter{
+		dir:    segmentsSpoolDir(ar.mic.spool.Path()),
+		tracks: map[string]*captureTrack{recordingTrackName: ar.mic},
+		queue:  make(chan liveSegment, segmentQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if ar.system != nil {
+		s.tracks = map[string]*captureTrack{micTrackName: ar.mic, systemTrackName: ar.system}
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		log.Printf("Failed to create segments directory, transcribing after stop: %v", err)
+		return
+	}
+
+	ar.segmenter = s
+	go ar.runSegmenter(s)
+	go ar.handleSegments(s)
+}
+
+func (ar *AudioRecorder) runSegmenter(s *segmenter) {
+	defer close(s.queue)
+
+	ticker := time.NewTicker(segmentInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for name, track := range s.tracks {
+			track.mu.Lock()
+			end := track.spool.DataSize()
+			track.mu.Unlock()
+
+			segment, err := ar.cutSegment(s.dir, name, track.spool.Path(), end)
+			if err != nil {
+				log.Printf("Failed to cut %s segment: %v", name, err)
+				continue
+			}
+			if segment == nil {
+				continue
+			}
+			select {
+			case s.queue <- *segment:
+			default:
+				log.Printf("Segment handler is behind, transcribing %s after stop", segment.File)
+			}
+		}
+	}
+}
+
+func (ar *AudioRecorder) handleSegments(s *segmenter) {
+	defer close(s.done)
+	for segment := range s.queue {
+		if ar.onSegment != nil {
+			ar.onSegment(s.dir, segment)
+		}
+	}
+}
+
+// finishSegments cuts what the spool files recorded after the last segment
+// of each track, so the segments cover the whole recording, and moves them
+// into workDir. systemSpool is "" for a recording without system audio.
+func (ar *AudioRecorder) finishSegments(dir, workDir, micSpool, systemSpool string) error {
+	spools := map[string]string{recordingTrackName: micSpool}
+	if systemSpool != "" {
+		spools = map[string]string{micTrackName: micSpool, systemTrackName: systemSpool}
+	}
+
+	segments, err := loadSegments(dir)
+	if err != nil {
+		return err
+	}
+	for name, spool := range spools {
+		if lastSegmentEnd(segments, name) == 0 {
+			// never cut, the track is transcribed whole
+			continue
+		}
+
+		file, err := os.Open(spool)
+		if err != nil {
+			return err
+		}
+		_, dataSize, err := readWAVFormat(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", spool, err)
+		}
+
+		if _, err := ar.cutSegment(dir, name, spool, dataSize); err != nil {
+			return err
+		}
+	}
+
+	return moveDir(dir, filepath.Join(workDir, segmentsDirName))
+}
+
+// cutSegment copies the track's audio from the end of its last segment up to
+// end bytes of PCM data into a new segment in dir, prepares it for upload and
+// adds it to the manifest. It returns nil when nothing new was recorded.
+func (ar *AudioRecorder) cutSegment(dir, track, spoolPath string, end int64) (*liveSegment, error) {
+	segments, err := loadSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := os.Open(spoolPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// the spool file may be from before the capture format was changed
+	format, _, err := readWAVFormat(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spoolPath, err)
+	}
+
+	start := format.offset(lastSegmentEnd(segments, track))
+	end -= end % int64(format.blockAlign())
+	if end <= start {
+		return nil, nil
+	}
+
+	index := 0
+	for _, segment := range segments {
+		if segment.Track == track {
+			index++
+		}
+	}
+	wavPath := filepath.Join(dir, fmt.Sprintf("%s_%03d.wav", track, index))
+	writer, err := createWAV(wavPath, format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(writer, io.NewSectionReader(src, wavHeaderSize+start, end-start)); err != nil {
+		writer.Close()
+		os.Remove(wavPath)
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		os.Remove(wavPath)
+		return nil, err
+	}
+
+	segment := liveSegment{
+		Track: track,
+		File:  filepath.Base(ar.prepareForUpload(wavPath)),
+		Start: format.duration(start).Seconds(),
+		End:   format.duration(end).Seconds(),
+	}
+	if err := saveSegments(dir, append(segments, segment)); err != nil {
+		return nil, err
+	}
+	return &segment, nil
+}
+
+// prepareTrack prepares the recorded track at wavPath in workDir for upload,
+// unless it was cut into live segments: those cover the whole track once the
+// recording is finished and are transcribed in its place.
+func (ar *AudioRecorder) prepareTrack(workDir, track, wavPath string) string {
+	segments, err := loadSegments(filepath.Join(workDir, segmentsDirName))
+	if err == nil && len(segmentsForTrack(segments, track)) > 0 {
+		return wavPath
+	}
+	return ar.prepareForUpload(wavPath)
+}
+
+// segmentsForTrack returns the segments a track was cut into, in order.
+func segmentsForTrack(segments []liveSegment, track string) []liveSegment {
+	var result []liveSegment
+	for _, segment := range segments {
+		if segment.Track == track {
+			result = append(result, segment)
+		}
+	}
+	return result
+}
+
+func lastSegmentEnd(segments []liveSegment, track string) float64 {
+	trackSegments := segmentsForTrack(segments, track)
+	if len(trackSegments) == 0 {
+		return 0
+	}
+	return trackSegments[len(trackSegments)-1].End
+}
+
+// loadSegments reads the segment manifest of dir. A directory without one
+// has no segments.
+func loadSegments(dir string) ([]liveSegment, error) {
+	data, err := os.ReadFile(filepath.Join(dir, segmentsManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []liveSegment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return nil, err
+	}
+	return segments, nil
+}
+
+func saveSegments(dir string, segments []liveSegment) error {
+	data, err := json.MarshalIndent(segments, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, segmentsManifest), data, 0644)
+}
+
+// moveDir moves a directory of plain files, falling back to moving them one
+// by one when the two paths are on different filesystems.
+func moveDir(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := moveFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(src)
+}
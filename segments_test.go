@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSegmentsCutWhileHandlerIsBusy(t *testing.T) {
+	interval := segmentInterval
+	segmentInterval = 50 * time.Millisecond
+	defer func() { segmentInterval = interval }()
+
+	feed := pipeStdin(t)
+	ar := newTestRecorder(t, "stdin")
+
+	// the first segment's upload hangs until released
+	var mu sync.Mutex
+	var handled []string
+	release := make(chan struct{})
+	ar.SetSegmentHandler(func(dir string, segment liveSegment) {
+		mu.Lock()
+		first := len(handled) == 0
+		handled = append(handled, segment.File)
+		mu.Unlock()
+		if first {
+			<-release
+		}
+	})
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	dir := ar.segmenter.dir
+
+	stopFeed := make(chan struct{})
+	fed := make(chan error, 1)
+	go func() {
+		tone := testTone(captureFormatPresets[speechFormat], 0.01)
+		for {
+			select {
+			case <-stopFeed:
+				fed <- nil
+				return
+			default:
+			}
+			if _, err := feed.Write(tone); err != nil {
+				fed <- err
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		segments, _ := loadSegments(dir)
+		if len(segments) >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d segments cut while the handler was busy, want 3", len(segments))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	close(stopFeed)
+	if err := <-fed; err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.StopRecording("test"); err != nil {
+		t.Fatal(err)
+	}
+	cut, err := loadSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionDir := t.TempDir()
+	audioFile, err := ar.SaveAudio(sessionDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if len(handled) != len(cut) {
+		t.Errorf("handler got %d of the %d segments cut while recording", len(handled), len(cut))
+	}
+	mu.Unlock()
+
+	// the segments are transcribed in place of the whole recording
+	if filepath.Base(audioFile) != "recording.wav" {
+		t.Errorf("saved %s, want the recording left unprocessed", filepath.Base(audioFile))
+	}
+	segments, err := loadSegments(filepath.Join(sessionDir, segmentsDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(audioFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, dataSize, err := wavData(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end := lastSegmentEnd(segments, recordingTrackName); end != format.duration(dataSize).Seconds() {
+		t.Errorf("segments end at %vs, recording is %vs long", end, format.duration(dataSize).Seconds())
+	}
+}
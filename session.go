@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+const sessionMetadataFile = "session.json"
+
+// sessionMetadata is saved next to the recording and describes how the audio
+// relates to the wall clock.
+type sessionMetadata struct {
+	StartTime    time.Time    `json:"start_time"`
+	EndTime      time.Time    `json:"end_time"`
+	StopReason   string       `json:"stop_reason,omitempty"`
+	ImportedFrom string       `json:"imported_from,omitempty"`
+	Pauses       []pausePoint `json:"pauses,omitempty"`
+	Markers      []marker     `json:"markers,omitempty"`
+}
+
+// pausePoint is a stretch of time left out of the recording. AudioOffset is
+// the position in the audio, in seconds, where the pause was cut out.
+type pausePoint struct {
+	AudioOffset float64   `json:"audio_offset"`
+	PausedAt    time.Time `json:"paused_at"`
+	ResumedAt   time.Time `json:"resumed_at"`
+}
+
+// marker is a moment flagged as important during the recording. AudioOffset
+// is its position in the audio, in seconds.
+type marker struct {
+	AudioOffset float64   `json:"audio_offset"`
+	MarkedAt    time.Time `json:"marked_at"`
+	Label       string    `json:"label,omitempty"`
+}
+
+func loadSessionMetadata(path string) (*sessionMetadata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata sessionMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func (m *sessionMetadata) save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// metadataSpoolPath names the metadata file kept in the spool directory next
+// to the microphone spool file until the recording is saved.
+func metadataSpoolPath(micSpool string) string {
+	return strings.TrimSuffix(micSpool, ".wav") + ".json"
+}
@@ -0,0 +1,52 @@
+package main
+
+// recorderState is where AudioRecorder is in its life cycle:
+//
+//	idle → starting → recording → stopping → stopped → (SaveAudio) idle
+//	idle → armed → starting → recording ...
+//	armed → stopping → idle
+//
+// Transitions happen while holding AudioRecorder.mu. The capture goroutines
+// only read the state, to know whether audio is still wanted.
+type recorderState int32
+
+const (
+	stateIdle recorderState = iota
+	// capturing into the rolling buffer
+	stateArmed
+	stateStarting
+	stateRecording
+	stateStopping
+	// capture has ended and the recording waits for SaveAudio
+	stateStopped
+)
+
+var recorderStateNames = [...]string{
+	stateIdle:      "idle",
+	stateArmed:     "armed",
+	stateStarting:  "starting",
+	stateRecording: "recording",
+	stateStopping:  "stopping",
+	stateStopped:   "stopped and not saved yet",
+}
+
+func (s recorderState) String() string {
+	return recorderStateNames[s]
+}
+
+func (ar *AudioRecorder) getState() recorderState {
+	return recorderState(ar.state.Load())
+}
+
+func (ar *AudioRecorder) setState(state recorderState) {
+	ar.state.Store(int32(state))
+}
+
+// capturing reports whether the capture goroutines should keep reading.
+func (ar *AudioRecorder) capturing() bool {
+	switch ar.getState() {
+	case stateArmed, stateStarting, stateRecording:
+		return true
+	}
+	return false
+}
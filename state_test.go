@@ -0,0 +1,238 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorderTransitions(t *testing.T) {
+	path, _ := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0.2)
+	ar := newTestRecorder(t, "file:"+path)
+
+	if err := ar.Pause(); err == nil {
+		t.Error("Pause succeeded while idle")
+	}
+	if err := ar.Resume(); err == nil {
+		t.Error("Resume succeeded while idle")
+	}
+	if err := ar.AddMarker("idle"); err == nil {
+		t.Error("AddMarker succeeded while idle")
+	}
+	if _, err := ar.SaveAudio(t.TempDir()); err == nil {
+		t.Error("SaveAudio succeeded while idle")
+	}
+	if err := ar.StopRecording("test"); err != nil {
+		t.Errorf("StopRecording while idle: %v", err)
+	}
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	// the recorder keeps recording after the file has run out
+	waitForCaptureEnd(t, ar)
+	if state := ar.getState(); state != stateRecording {
+		t.Fatalf("recorder is %s after StartRecording, want recording", state)
+	}
+	if err := ar.StartRecording(); err == nil || !strings.Contains(err.Error(), "recorder is recording") {
+		t.Errorf("second StartRecording: %v, want recorder is recording", err)
+	}
+	if err := ar.Arm(1); err == nil {
+		t.Error("Arm succeeded while recording")
+	}
+
+	if err := ar.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.Pause(); err != nil {
+		t.Errorf("pausing twice: %v", err)
+	}
+	if err := ar.AddMarker("paused"); err != nil {
+		t.Errorf("AddMarker while paused: %v", err)
+	}
+	if err := ar.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.Resume(); err != nil {
+		t.Errorf("resuming twice: %v", err)
+	}
+
+	if err := ar.StopRecording("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.StopRecording("again"); err != nil {
+		t.Errorf("second StopRecording: %v", err)
+	}
+	if state := ar.getState(); state != stateStopped {
+		t.Fatalf("recorder is %s after StopRecording, want stopped", state)
+	}
+
+	if err := ar.StartRecording(); err == nil || !strings.Contains(err.Error(), "stopped and not saved yet") {
+		t.Errorf("StartRecording before SaveAudio: %v, want stopped and not saved yet", err)
+	}
+	if err := ar.Pause(); err == nil {
+		t.Error("Pause succeeded after StopRecording")
+	}
+	if err := ar.AddMarker("stopped"); err == nil {
+		t.Error("AddMarker succeeded after StopRecording")
+	}
+	if err := ar.Arm(1); err == nil {
+		t.Error("Arm succeeded before SaveAudio")
+	}
+
+	if _, err := ar.SaveAudio(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if state := ar.getState(); state != stateIdle {
+		t.Fatalf("recorder is %s after SaveAudio, want idle", state)
+	}
+	if _, err := ar.SaveAudio(t.TempDir()); err == nil {
+		t.Error("second SaveAudio succeeded")
+	}
+
+	// and the next recording starts as the first did
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	waitForCaptureEnd(t, ar)
+	if err := ar.StopRecording("test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ar.SaveAudio(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecorderArmedTransitions(t *testing.T) {
+	path, pcm := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 0.5)
+	ar := newTestRecorder(t, "file:"+path)
+
+	if err := ar.Arm(0); err == nil {
+		t.Error("arming a 0-minute buffer succeeded")
+	}
+	if err := ar.Arm(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ar.Arm(1); err != nil {
+		t.Errorf("arming twice: %v", err)
+	}
+	if state := ar.getState(); state != stateArmed {
+		t.Fatalf("recorder is %s after Arm, want armed", state)
+	}
+	if err := ar.Pause(); err == nil {
+		t.Error("Pause succeeded while armed")
+	}
+	if err := ar.StopRecording("test"); err == nil {
+		t.Error("StopRecording succeeded while armed")
+	}
+
+	ar.Disarm()
+	if state := ar.getState(); state != stateIdle {
+		t.Fatalf("recorder is %s after Disarm, want idle", state)
+	}
+	ar.Disarm()
+
+	// saving the buffer keeps what was captured before Start
+	if err := ar.Arm(1); err != nil {
+		t.Fatal(err)
+	}
+	waitForCaptureEnd(t, ar)
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if state := ar.getState(); state != stateRecording {
+		t.Fatalf("recorder is %s after saving the buffer, want recording", state)
+	}
+	recordAndSave(t, ar, pcm)
+}
+
+func TestSaveBufferWhileCapturing(t *testing.T) {
+	pcm := testTone(captureFormatPresets[speechFormat], 1)
+	feed := pipeStdin(t)
+	ar := newTestRecorder(t, "stdin")
+
+	if err := ar.Arm(1); err != nil {
+		t.Fatal(err)
+	}
+	// audio keeps arriving while the buffer becomes the recording
+	fed := make(chan error, 1)
+	go func() {
+		for part := pcm; len(part) > 0; {
+			n := min(len(part), 640)
+			if _, err := feed.Write(part[:n]); err != nil {
+				fed <- err
+				return
+			}
+			part = part[n:]
+			time.Sleep(time.Millisecond)
+		}
+		fed <- feed.Close()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-fed; err != nil {
+		t.Fatal(err)
+	}
+
+	waitForCaptureEnd(t, ar)
+	recordAndSave(t, ar, pcm)
+}
+
+func TestRecorderConcurrentControls(t *testing.T) {
+	path, _ := writeTestWAV(t, t.TempDir(), captureFormatPresets[speechFormat], 2)
+	ar := newTestRecorder(t, "file:"+path)
+
+	if err := ar.StartRecording(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ar.GetAudioSize() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("no audio recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// errors are expected once a Stop has won
+			for j := 0; j < 50; j++ {
+				ar.Pause()
+				ar.AddMarker("mark")
+				ar.GetAudioSize()
+				ar.Resume()
+			}
+		}()
+	}
+
+	stopErrs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopErrs <- ar.StopRecording("test")
+		}()
+	}
+	wg.Wait()
+	close(stopErrs)
+
+	for err := range stopErrs {
+		if err != nil {
+			t.Errorf("concurrent StopRecording: %v", err)
+		}
+	}
+	if state := ar.getState(); state != stateStopped {
+		t.Fatalf("recorder is %s after the Stop calls, want stopped", state)
+	}
+	if ar.paused.Load() {
+		t.Error("recorder still paused after StopRecording")
+	}
+	if _, err := ar.SaveAudio(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// a dropped stream is retried for this long before the recording gives up
+	streamReconnectWindow = 2 * time.Minute
+	streamMaxBackoff      = 10 * time.Second
+)
+
+// isStreamURL reports whether spec is the URL of a network stream ffmpeg can
+// record: HTTP (which includes Icecast and SHOUTcast), RTSP or RTMP.
+func isStreamURL(spec string) bool {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "rtsp", "rtsps", "rtmp", "rtmps":
+		return true
+	}
+	return false
+}
+
+// streamSource records a network stream through ffmpeg. When the stream
+// drops after it has delivered audio, ffmpeg is restarted until it comes back
+// or streamReconnectWindow passes, and the time lost is filled with silence
+// so positions in the recording keep matching the clock. A server closing a
+// live stream looks to ffmpeg like the end of a file, so only Stop ends the
+// stream; one that really ended fails to reconnect.
+type streamSource struct {
+	url    string
+	scheme string
+	format wavFormat
+	report func(line string)
+	stream *streamReader
+}
+
+func newStreamSource(streamURL string, format wavFormat) *streamSource {
+	scheme := ""
+	if u, err := url.Parse(streamURL); err == nil {
+		scheme = strings.ToLower(u.Scheme)
+	}
+	return &streamSource{url: streamURL, scheme: scheme, format: format}
+}
+
+func (s *streamSource) Name() string {
+	return "stream"
+}
+
+func (s *streamSource) Devices() ([]InputDevice, error) {
+	return nil, nil
+}
+
+func (s *streamSource) ReportOutput(report func(line string)) {
+	s.report = report
+}
+
+func (s *streamSource) Start() (io.ReadCloser, error) {
+	if !isCommandAvailable("ffmpeg") {
+		return nil, fmt.Errorf("ffmpeg is required to record streams")
+	}
+
+	s.stream = &streamReader{source: s, stop: make(chan struct{})}
+	if err := s.stream.connect(); err != nil {
+		return nil, err
+	}
+	return s.stream, nil
+}
+
+func (s *streamSource) Stop() error {
+	if s.stream == nil {
+		return nil
+	}
+	s.stream.halt()
+	return nil
+}
+
+func (s *streamSource) args() []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin"}
+	switch s.scheme {
+	case "http", "https":
+		// short network hiccups are bridged by ffmpeg itself
+		args = append(args, "-reconnect", "1", "-reconnect_streamed", "1", "-reconnect_delay_max", "10")
+	case "rtsp", "rtsps":
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	// -re keeps a server that serves a plain file from delivering it faster
+	// than it plays
+	args = append(args, "-re", "-i", s.url, "-vn")
+	return append(args, "-ar", strconv.Itoa(s.format.SampleRate), "-ac", strconv.Itoa(s.format.Channels), "-f", "s16le", "-")
+}
+
+func (s *streamSource) log(line string) {
+	if s.report != nil {
+		s.report(line)
+	}
+}
+
+// streamReader is the PCM stream of a streamSource across reconnects.
+type streamReader struct {
+	source *streamSource
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stopped bool
+
+	// received is set once audio arrived; a stream that never delivered
+	// anything is not retried
+	received bool
+	lastData time.Time
+	lostAt   time.Time
+	backoff  time.Duration
+	// bytes delivered, to keep reconnects aligned to whole samples
+	delivered int64
+	// silence still owed for a reconnect, and the audio that arrived after it
+	silence int64
+	pending []byte
+}
+
+func (r *streamReader) connect() error {
+	cmd := exec.Command("ffmpeg", r.source.args()...)
+	cmd.Stderr = &lineWriter{report: r.source.log}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return io.EOF
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	r.cmd, r.stdout = cmd, stdout
+	return nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for {
+		if r.silence > 0 {
+			n := int(min(int64(len(p)), r.silence))
+			clear(p[:n])
+			r.silence -= int64(n)
+			return n, nil
+		}
+		if len(r.pending) > 0 {
+			n := copy(p, r.pending)
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+
+		r.mu.Lock()
+		stdout, cmd, stopped := r.stdout, r.cmd, r.stopped
+		r.mu.Unlock()
+		if stopped {
+			return 0, io.EOF
+		}
+
+		if stdout != nil {
+			n, err := stdout.Read(p)
+			if n > 0 {
+				if r.resumed(p[:n]) {
+					continue
+				}
+				return n, nil
+			}
+			if err == nil {
+				continue
+			}
+
+			waitErr := cmd.Wait()
+			r.mu.Lock()
+			r.stdout, r.cmd = nil, nil
+			stopped = r.stopped
+			r.mu.Unlock()
+			if stopped {
+				return 0, io.EOF
+			}
+			if !r.received {
+				if waitErr == nil {
+					return 0, fmt.Errorf("stream ended before any audio arrived")
+				}
+				return 0, fmt.Errorf("ffmpeg exited: %w", waitErr)
+			}
+			if r.lostAt.IsZero() {
+				r.lostAt = time.Now()
+				r.backoff = time.Second
+			}
+		}
+
+		if time.Since(r.lostAt) > streamReconnectWindow {
+			return 0, fmt.Errorf("stream lost for over %s", streamReconnectWindow)
+		}
+		r.source.log(fmt.Sprintf("stream dropped, reconnecting in %s", r.backoff))
+		select {
+		case <-r.stop:
+			return 0, io.EOF
+		case <-time.After(r.backoff):
+		}
+		r.backoff = min(2*r.backoff, streamMaxBackoff)
+		if err := r.connect(); err != nil && err != io.EOF {
+			r.source.log(err.Error())
+		}
+	}
+}
+
+// resumed accounts for audio read from ffmpeg. When it is the first after a
+// reconnect, it is held back behind the silence that stands in for the
+// outage and resumed returns true.
+func (r *streamReader) resumed(data []byte) bool {
+	r.received = true
+	now := time.Now()
+	if r.lostAt.IsZero() {
+		r.lastData = now
+		r.delivered += int64(len(data))
+		return false
+	}
+
+	// a drop can cut a sample in half
+	blockAlign := int64(r.source.format.blockAlign())
+	r.silence = (blockAlign - r.delivered%blockAlign) % blockAlign
+	r.silence += r.source.format.offset(now.Sub(r.lastData).Seconds())
+	r.pending = append(r.pending[:0], data...)
+	r.source.log(fmt.Sprintf("stream reconnected after %s", now.Sub(r.lostAt).Round(time.Second)))
+
+	r.lostAt, r.lastData = time.Time{}, now
+	r.delivered = int64(len(data))
+	return true
+}
+
+// halt ends the stream so that a pending Read returns.
+func (r *streamReader) halt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	r.stopped = true
+	close(r.stop)
+	if r.cmd != nil && r.cmd.Process != nil {
+		r.cmd.Process.Kill()
+	}
+}
+
+func (r *streamReader) Close() error {
+	r.halt()
+	r.mu.Lock()
+	cmd, stdout := r.cmd, r.stdout
+	r.cmd, r.stdout = nil, nil
+	r.mu.Unlock()
+	if stdout != nil {
+		stdout.Close()
+	}
+	if cmd != nil {
+		// killed by halt, so its exit status says nothing
+		cmd.Wait()
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary stands in for ffmpeg, see useFakeFFmpeg
+	if filepath.Base(os.Args[0]) == "ffmpeg" {
+		os.Exit(fakeFFmpeg(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeFFmpeg records a stream the way streamSource runs ffmpeg, for a server
+// that already sends PCM in the capture format: it copies what is served at
+// the -i URL to stdout, less the header of a WAV file. Given a file instead,
+// it decodes it the way ImportAudio runs ffmpeg, for a file that already is
+// a WAV file in the capture format: it copies it to the last argument.
+func fakeFFmpeg(args []string) int {
+	var input string
+	for i, arg := range args {
+		if arg == "-i" && i+1 < len(args) {
+			input = args[i+1]
+		}
+	}
+
+	if !isStreamURL(input) {
+		data, err := os.ReadFile(input)
+		if err == nil {
+			err = os.WriteFile(args[len(args)-1], data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	resp, err := http.Get(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%s: server returned %s\n", input, resp.Status)
+		return 1
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if magic, err := body.Peek(4); err == nil && string(magic) == "RIFF" {
+		body.Discard(wavHeaderSize)
+	}
+	if _, err := io.Copy(os.Stdout, body); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// useFakeFFmpeg puts the test binary on PATH as ffmpeg.
+func useFakeFFmpeg(t *testing.T) {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(dir, "ffmpeg")); err != nil {
+		t.Skipf("cannot link the test binary as ffmpeg: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestStreamReconnectsAfterServerCloses(t *testing.T) {
+	useFakeFFmpeg(t)
+	format := captureFormatPresets[speechFormat]
+
+	wavPath, first := writeTestWAV(t, t.TempDir(), format, 0.3)
+	wav, err := os.ReadFile(wavPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := testTone(format, 0.2)
+	for i := range second {
+		second[i] ^= 0x55
+	}
+
+	// the server ends the stream cleanly twice, first as WAV, then as raw
+	// PCM, and is gone afterwards
+	var requests atomic.Int32
+	gone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.Write(wav)
+		case 2:
+			w.Write(second)
+		case 3:
+			close(gone)
+			fallthrough
+		default:
+			http.Error(w, "stream is over", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ar := newTestRecorder(t, "")
+	if err := ar.RecordStream(server.URL + "/live"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-gone:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("stream was requested %d times, want a reconnect after each end", requests.Load())
+	}
+
+	spool := ar.mic.spool.Path()
+	if err := ar.StopRecording("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, _, err := readWAVFormat(file); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, first) || !bytes.HasSuffix(data, second) {
+		t.Fatalf("recording of %d bytes does not hold both parts of the stream in order", len(data))
+	}
+	gap := data[len(first) : len(data)-len(second)]
+	if len(gap)%format.blockAlign() != 0 || len(gap) < int(format.offset(0.5)) {
+		t.Errorf("reconnect gap is %d bytes, want about a second of whole samples", len(gap))
+	}
+	if bytes.ContainsFunc(gap, func(r rune) bool { return r != 0 }) {
+		t.Error("reconnect gap is not silent")
+	}
+
+	if _, err := ar.SaveAudio(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamWithoutAudioFails(t *testing.T) {
+	useFakeFFmpeg(t)
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"missing": func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		},
+		"empty": func(w http.ResponseWriter, r *http.Request) {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			ar := newTestRecorder(t, "")
+			if err := ar.RecordStream(server.URL); err != nil {
+				t.Fatal(err)
+			}
+			defer ar.StopRecording("test")
+
+			timeout := time.After(10 * time.Second)
+			for {
+				select {
+				case status := <-ar.Status():
+					if strings.Contains(status.Message, "reconnecting") {
+						t.Fatalf("stream without audio was retried: %s", status.Message)
+					}
+					if status.Kind == gui.StatusCaptureStopped {
+						if !status.Fatal {
+							t.Errorf("status %+v, want the recording lost", status)
+						}
+						return
+					}
+				case <-timeout:
+					t.Fatal("stream without audio did not fail")
+				}
+			}
+		})
+	}
+}
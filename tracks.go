@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	micTrackName    = "track_mic"
+	systemTrackName = "track_system"
+)
+
+// findTrack returns the compressed or original file of a recorded track in
+// dir, or "" if the session has no such track.
+func findTrack(dir, name string) string {
+	for _, candidate := range []string{name + compressedSuffix, name + ".wav"} {
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// systemSpoolPath names the system audio spool file recorded alongside the
+// microphone spool file micSpool.
+func systemSpoolPath(micSpool string) string {
+	return strings.TrimSuffix(micSpool, ".wav") + "_system.wav"
+}
+
+// finishTracks moves the microphone and system audio spool files into workDir
+// and hands over to mixTracks. It returns the path of the mix.
+func (ar *AudioRecorder) finishTracks(workDir, micSpool, systemSpool string) (string, error) {
+	if err := moveFile(micSpool, filepath.Join(workDir, micTrackName+".wav")); err != nil {
+		return "", err
+	}
+	if err := moveFile(systemSpool, filepath.Join(workDir, systemTrackName+".wav")); err != nil {
+		return "", err
+	}
+
+	return ar.mixTracks(workDir)
+}
+
+// mixTracks mixes the two tracks in workDir into recording.wav, which is kept
+// as the session recording, and prepares the tracks themselves for upload.
+func (ar *AudioRecorder) mixTracks(workDir string) (string, error) {
+	micPath := filepath.Join(workDir, micTrackName+".wav")
+	systemPath := filepath.Join(workDir, systemTrackName+".wav")
+
+	mixPath := filepath.Join(workDir, "recording.wav")
+	if err := mixWAVFiles(mixPath, micPath, systemPath); err != nil {
+		return "", fmt.Errorf("failed to mix tracks: %w", err)
+	}
+
+	ar.prepareTrack(workDir, micTrackName, micPath)
+	ar.prepareTrack(workDir, systemTrackName, systemPath)
+
+	return mixPath, nil
+}
+
+// mixWAVFiles sums two 16-bit PCM WAV files of the same format into out. The
+// shorter input is padded with silence.
+func mixWAVFiles(out, first, second string) error {
+	a, err := os.Open(first)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	b, err := os.Open(second)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	formatA, sizeA, err := readWAVFormat(a)
+	if err != nil {
+		return fmt.Errorf("%s: %w", first, err)
+	}
+	formatB, sizeB, err := readWAVFormat(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", second, err)
+	}
+	if formatA != formatB || formatA.BitsPerSample != 16 {
+		return fmt.Errorf("tracks have different formats")
+	}
+
+	writer, err := createWAV(out, formatA)
+	if err != nil {
+		return err
+	}
+
+	readerA := io.LimitReader(a, sizeA)
+	readerB := io.LimitReader(b, sizeB)
+	bufA := make([]byte, 8192)
+	bufB := make([]byte, 8192)
+	mixed := make([]byte, 8192)
+
+	for {
+		nA, errA := io.ReadFull(readerA, bufA)
+		nB, errB := io.ReadFull(readerB, bufB)
+		n := max(nA, nB) &^ 1
+		if n == 0 {
+			break
+		}
+
+		for i := 0; i < n; i += 2 {
+			var sum int32
+			if i+1 < nA {
+				sum += int32(int16(binary.LittleEndian.Uint16(bufA[i:])))
+			}
+			if i+1 < nB {
+				sum += int32(int16(binary.LittleEndian.Uint16(bufB[i:])))
+			}
+			sum = min(max(sum, math.MinInt16), math.MaxInt16)
+			binary.LittleEndian.PutUint16(mixed[i:], uint16(int16(sum)))
+		}
+
+		if _, err := writer.Write(mixed[:n]); err != nil {
+			writer.Close()
+			return err
+		}
+
+		if errA != nil && errB != nil {
+			break
+		}
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Transcriber turns an audio file into transcript segments positioned in it.
+// Cancelling ctx abandons a transcription under way.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioFile, language, prompt string) ([]transcriptSegment, error)
+	// MaxFileSize is the largest file Transcribe takes at once, larger files
+	// are split into chunks first. Zero means there is no limit.
+	MaxFileSize() int64
+}
+
+// transcriber returns the backend for a model setting: a local model when it
+// names one, an OpenAI model otherwise.
+func (p *OpenAIProcessor) transcriber(model string) (Transcriber, error) {
+	if isLocalModel(model) {
+		return newWhisperTranscriber(p.config, strings.TrimPrefix(model, localModelPrefix))
+	}
+	endpoint, err := p.transcriptionEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	if p.config.UsesAzure() {
+		// the deployment decides the model, requests don't name one
+		return &openAITranscriber{endpoint: endpoint, segments: supportsSegments(p.config.GetAzureTranscriptionModel())}, nil
+	}
+	return &openAITranscriber{endpoint: endpoint, model: model, segments: supportsSegments(model)}, nil
+}
+
+// openAITranscriber uploads audio to the OpenAI transcription API, or a
+// server that implements it. model is "" for a server that picks the model
+// itself; segments asks for per-segment timestamps.
+type openAITranscriber struct {
+	endpoint apiEndpoint
+	model    string
+	segments bool
+}
+
+type openAITranscriptionResponse struct {
+	Text     string              `json:"text"`
+	Segments []transcriptSegment `json:"segments"`
+}
+
+// maxUploadSize is the largest file the OpenAI transcription API accepts.
+const maxUploadSize = 25 * 1024 * 1024
+
+func (t *openAITranscriber) MaxFileSize() int64 {
+	return maxUploadSize
+}
+
+// supportsSegments reports whether a transcription model can return
+// verbose_json with per-segment timestamps. Azure calls Whisper "whisper".
+func supportsSegments(model string) bool {
+	return model == "whisper-1" || model == "whisper"
+}
+
+func (t *openAITranscriber) Transcribe(ctx context.Context, audioFile, language, prompt string) ([]transcriptSegment, error) {
+	file, err := os.Open(audioFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(audioFile))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+
+	if t.model != "" {
+		writer.WriteField("model", t.model)
+	}
+	if language != "auto" {
+		writer.WriteField("language", language)
+	}
+
+	if prompt != "" {
+		writer.WriteField("prompt", prompt)
+	}
+	if t.segments {
+		writer.WriteField("response_format", "verbose_json")
+		writer.WriteField("timestamp_granularities[]", "segment")
+	}
+	writer.Close()
+
+	req, err := t.endpoint.newRequest(ctx, "/audio/transcriptions", writer.FormDataContentType(), &requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("DEBUG: Transcription API Error - Status: %d, Headers: %v, Body: %s\n", resp.StatusCode, resp.Header, string(body))
+		return nil, fmt.Errorf("API error %d from %s: %s", resp.StatusCode, req.URL.Host, string(body))
+	}
+
+	var transcription openAITranscriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&transcription); err != nil {
+		return nil, err
+	}
+
+	if len(transcription.Segments) > 0 {
+		return transcription.Segments, nil
+	}
+	if strings.TrimSpace(transcription.Text) == "" {
+		return nil, nil
+	}
+	return []transcriptSegment{{Text: transcription.Text}}, nil
+}
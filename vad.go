@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	vadFrameMillis = 30
+	// silences longer than vadMaxSilence are shortened to vadKeptSilence
+	vadMaxSilenceMillis  = 2000
+	vadKeptSilenceMillis = 500
+	// speech frames are padded so word onsets and tails are not clipped
+	vadPaddingMillis = 300
+	// below this level nothing counts as speech however quiet the room is
+	vadMinThreshold = 0.003
+)
+
+// speechMap records which parts of the original recording were kept when
+// silence was trimmed, so positions in the trimmed audio can be mapped back.
+type speechMap struct {
+	Regions []speechRegion `json:"regions"`
+}
+
+// speechRegion is a stretch of original audio, in seconds, that starts at
+// Trimmed in the trimmed audio and at Original in the recording.
+type speechRegion struct {
+	Trimmed  float64 `json:"trimmed"`
+	Original float64 `json:"original"`
+	Duration float64 `json:"duration"`
+}
+
+func (m *speechMap) toOriginal(position float64) float64 {
+	i := sort.Search(len(m.Regions), func(i int) bool {
+		return m.Regions[i].Trimmed > position
+	}) - 1
+	if i < 0 {
+		return position
+	}
+	region := m.Regions[i]
+	return region.Original + math.Min(position-region.Trimmed, region.Duration)
+}
+
+func (m *speechMap) remap(segments []transcriptSegment) {
+	for i := range segments {
+		segments[i].Start = m.toOriginal(segments[i].Start)
+		segments[i].End = m.toOriginal(segments[i].End)
+	}
+}
+
+// speechFileBase is the name a recording's trimmed speech version is stored
+// under, e.g. "track_mic_speech" for track_mic_compressed.flac.
+func speechFileBase(audioFile string) string {
+	base := strings.TrimSuffix(filepath.Base(audioFile), filepath.Ext(audioFile))
+	return strings.TrimSuffix(base, "_compressed") + "_speech"
+}
+
+// findSpeechVersion returns the trimmed version of audioFile and its map, or
+// "" and nil when silence was not trimmed for it.
+func findSpeechVersion(audioFile string) (string, *speechMap) {
+	dir := filepath.Dir(audioFile)
+	base := speechFileBase(audioFile)
+
+	speechFile := findTrack(dir, base)
+	if speechFile == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, base+".json"))
+	if err != nil {
+		return "", nil
+	}
+	var offsets speechMap
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		return "", nil
+	}
+
+	return speechFile, &offsets
+}
+
+// trimSilence writes a copy of wavPath with long silent stretches shortened,
+// next to it as <base>.wav along with its speechMap. It returns "" when there
+// is too little silence for trimming to be worth it.
+func trimSilence(wavPath, base string) (string, error) {
+	file, err := os.Open(wavPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	format, dataSize, err := readWAVFormat(file)
+	if err != nil {
+		return "", err
+	}
+	if format.BitsPerSample != 16 {
+		return "", fmt.Errorf("silence trimming needs 16-bit audio")
+	}
+	dataStart, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+
+	// frames hold whole samples of every channel, so at rates such as
+	// 11025 Hz they are a fraction of a millisecond off vadFrameMillis
+	samplesPerFrame := format.SampleRate * vadFrameMillis / 1000
+	frameBytes := samplesPerFrame * format.Channels * 2
+	frameSeconds := float64(samplesPerFrame) / float64(format.SampleRate)
+	energies, err := frameEnergies(io.LimitReader(file, dataSize), frameBytes)
+	if err != nil {
+		return "", err
+	}
+	if len(energies) == 0 {
+		return "", nil
+	}
+
+	kept := keptFrames(energies)
+	keptCount := 0
+	for _, interval := range kept {
+		keptCount += interval[1] - interval[0]
+	}
+	if keptCount*100 >= len(energies)*95 {
+		return "", nil
+	}
+
+	speechPath := filepath.Join(filepath.Dir(wavPath), base+".wav")
+	writer, err := createWAV(speechPath, format)
+	if err != nil {
+		return "", err
+	}
+
+	offsets := speechMap{}
+	buffer := make([]byte, frameBytes)
+	var trimmedBytes int64
+	for _, interval := range kept {
+		// regions are measured in the bytes actually copied, as the last
+		// frame of the recording is usually shorter than the others
+		start := int64(interval[0]) * int64(frameBytes)
+		regionBytes := int64(0)
+		for frame := interval[0]; frame < interval[1]; frame++ {
+			n, err := file.ReadAt(buffer, dataStart+int64(frame)*int64(frameBytes))
+			n -= n % format.blockAlign()
+			if n > 0 {
+				if _, werr := writer.Write(buffer[:n]); werr != nil {
+					writer.Close()
+					return "", werr
+				}
+				regionBytes += int64(n)
+			}
+			if err != nil && err != io.EOF {
+				writer.Close()
+				return "", err
+			}
+		}
+
+		offsets.Regions = append(offsets.Regions, speechRegion{
+			Trimmed:  format.duration(trimmedBytes).Seconds(),
+			Original: format.duration(start).Seconds(),
+			Duration: format.duration(regionBytes).Seconds(),
+		})
+		trimmedBytes += regionBytes
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(offsets, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(wavPath), base+".json"), data, 0644); err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Silence trimmed: %.1f min -> %.1f min\n",
+		float64(len(energies))*frameSeconds/60, format.duration(trimmedBytes).Minutes())
+
+	return speechPath, nil
+}
+
+func frameEnergies(r io.Reader, frameBytes int) ([]float64, error) {
+	var energies []float64
+	buffer := make([]byte, frameBytes)
+	for {
+		n, err := io.ReadFull(r, buffer)
+		samples := n / 2
+		if samples > 0 {
+			var sumSquares float64
+			for i := 0; i < samples; i++ {
+				sample := float64(int16(binary.LittleEndian.Uint16(buffer[i*2:])))
+				sumSquares += sample * sample
+			}
+			energies = append(energies, math.Sqrt(sumSquares/float64(samples))/32768)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return energies, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// speechThreshold returns the frame energy above which a frame counts as
+// speech. It adapts to the noise floor, taken as the 10th percentile of frame
+// energies, which is returned too.
+func speechThreshold(energies []float64) (threshold, noiseFloor float64) {
+	sorted := append([]float64(nil), energies...)
+	sort.Float64s(sorted)
+	noiseFloor = sorted[len(sorted)/10]
+	return math.Max(noiseFloor*3, vadMinThreshold), noiseFloor
+}
+
+// keptFrames decides which frames to keep and returns them as merged
+// [start, end) intervals.
+func keptFrames(energies []float64) [][2]int {
+	threshold, _ := speechThreshold(energies)
+
+	padding := vadPaddingMillis / vadFrameMillis
+	speech := make([]bool, len(energies))
+	for i, energy := range energies {
+		if energy <= threshold {
+			continue
+		}
+		for j := max(0, i-padding); j <= min(len(energies)-1, i+padding); j++ {
+			speech[j] = true
+		}
+	}
+
+	maxSilence := vadMaxSilenceMillis / vadFrameMillis
+	keptEdge := vadKeptSilenceMillis / vadFrameMillis / 2
+
+	var kept [][2]int
+	keep := func(start, end int) {
+		if start >= end {
+			return
+		}
+		if last := len(kept) - 1; last >= 0 && kept[last][1] == start {
+			kept[last][1] = end
+			return
+		}
+		kept = append(kept, [2]int{start, end})
+	}
+
+	for start := 0; start < len(speech); {
+		end := start
+		for end < len(speech) && speech[end] == speech[start] {
+			end++
+		}
+
+		if speech[start] || end-start <= maxSilence {
+			keep(start, end)
+		} else {
+			// keep a little silence on each side so pauses still read as pauses
+			keep(start, start+keptEdge)
+			keep(end-keptEdge, end)
+		}
+		start = end
+	}
+
+	return kept
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrimSilenceKeepsWholeSamples(t *testing.T) {
+	for _, format := range []wavFormat{
+		{SampleRate: 11025, Channels: 1, BitsPerSample: 16},
+		{SampleRate: 22050, Channels: 2, BitsPerSample: 16},
+		{SampleRate: 16000, Channels: 1, BitsPerSample: 16},
+	} {
+		t.Run(format.String(), func(t *testing.T) {
+			dir := t.TempDir()
+
+			// speech, a long pause and speech that ends mid-frame
+			var pcm []byte
+			pcm = append(pcm, testTone(format, 2)...)
+			pcm = append(pcm, make([]byte, format.offset(6))...)
+			pcm = append(pcm, testTone(format, 1.5)...)
+			pcm = append(pcm, testTone(format, 7/float64(format.SampleRate))...)
+
+			wavPath := filepath.Join(dir, "recording.wav")
+			writer, err := createWAV(wavPath, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writer.Write(pcm)
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			speechPath, err := trimSilence(wavPath, "recording_speech")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if speechPath == "" {
+				t.Fatal("a six-second pause was not trimmed")
+			}
+
+			file, err := os.Open(speechPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			speechFormat, speechSize, err := readWAVFormat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if speechFormat != format {
+				t.Errorf("trimmed format = %s, want %s", speechFormat, format)
+			}
+			if speechSize%int64(format.blockAlign()) != 0 {
+				t.Errorf("trimmed data size %d is not a whole number of %d-byte samples", speechSize, format.blockAlign())
+			}
+
+			_, offsets := findSpeechVersion(filepath.Join(dir, "recording_compressed.flac"))
+			if offsets == nil {
+				t.Fatal("no speech map written")
+			}
+			var mapped float64
+			for _, region := range offsets.Regions {
+				mapped += region.Duration
+			}
+			if trimmed := format.duration(speechSize).Seconds(); math.Abs(mapped-trimmed) > 1e-6 {
+				t.Errorf("map covers %.6f s of %.6f s trimmed audio", mapped, trimmed)
+			}
+
+			original := format.duration(int64(len(pcm))).Seconds()
+			if end := offsets.toOriginal(format.duration(speechSize).Seconds()); math.Abs(end-original) > 1e-6 {
+				t.Errorf("end of trimmed audio maps to %.6f s, want %.6f s", end, original)
+			}
+		})
+	}
+}
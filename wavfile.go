@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const wavHeaderSize = 44
+
+// wavWriter streams 16-bit PCM into a WAV file. The RIFF and data chunk sizes
+// are written as zero up front and patched on Close, so the file on disk is
+// always a valid WAV prefix that repairWAVHeader can fix after a crash.
+type wavWriter struct {
+	file     *os.File
+	dataSize int64
+	closed   bool
+}
+
+func createWAV(path string, format wavFormat) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := wavHeader(format, 0)
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &wavWriter{file: file}, nil
+}
+
+func (w *wavWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.dataSize += int64(n)
+	return n, err
+}
+
+func (w *wavWriter) DataSize() int64 {
+	return w.dataSize
+}
+
+func (w *wavWriter) Path() string {
+	return w.file.Name()
+}
+
+func (w *wavWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := patchWAVSizes(w.file, w.dataSize); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+func wavHeader(format wavFormat, dataSize uint32) []byte {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], 36+dataSize)
+	copy(header[8:12], "WAVE")
+	copy(header[12:16], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:20], 16)
+	binary.LittleEndian.PutUint16(header[20:22], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:24], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(header[24:28], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:32], uint32(format.byteRate()))
+	binary.LittleEndian.PutUint16(header[32:34], uint16(format.blockAlign()))
+	binary.LittleEndian.PutUint16(header[34:36], uint16(format.BitsPerSample))
+	copy(header[36:40], "data")
+	binary.LittleEndian.PutUint32(header[40:44], dataSize)
+	return header
+}
+
+func patchWAVSizes(file *os.File, dataSize int64) error {
+	if dataSize > 0xFFFFFFFF-36 {
+		return fmt.Errorf("recording too large for WAV: %d bytes", dataSize)
+	}
+
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(36+dataSize))
+	if _, err := file.WriteAt(buf[:], 4); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(buf[:], uint32(dataSize))
+	_, err := file.WriteAt(buf[:], 40)
+	return err
+}
+
+// repairWAVHeader rewrites the size fields of a spool file whose writer never
+// reached Close, using the file length to recover the amount of PCM data.
+func repairWAVHeader(path string) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < wavHeaderSize {
+		return 0, fmt.Errorf("truncated WAV header in %s", path)
+	}
+	format, _, err := readWAVFormat(file)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	if format.blockAlign() == 0 {
+		return 0, fmt.Errorf("invalid WAV format in %s", path)
+	}
+
+	// drop a trailing partial sample so the data chunk stays block aligned
+	dataSize := info.Size() - wavHeaderSize
+	dataSize -= dataSize % int64(format.blockAlign())
+	if err := patchWAVSizes(file, dataSize); err != nil {
+		return 0, err
+	}
+
+	return dataSize, nil
+}
+
+type wavFormat struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// readWAVFormat parses the chunks of a PCM WAV file up to the data chunk and
+// leaves r positioned at the first sample.
+func readWAVFormat(r io.Reader) (wavFormat, int64, error) {
+	var format wavFormat
+
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return format, 0, err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return format, 0, fmt.Errorf("not a WAV file")
+	}
+
+	haveFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return format, 0, fmt.Errorf("no data chunk: %w", err)
+		}
+		chunkID := string(chunk[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch chunkID {
+		case "fmt ":
+			if chunkSize < 16 {
+				return format, 0, fmt.Errorf("invalid fmt chunk")
+			}
+			body := make([]byte, chunkSize+chunkSize%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return format, 0, err
+			}
+			if audioFormat := binary.LittleEndian.Uint16(body[0:2]); audioFormat != 1 {
+				return format, 0, fmt.Errorf("unsupported WAV encoding %d, PCM required", audioFormat)
+			}
+			format.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			format.SampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			format.BitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return format, 0, fmt.Errorf("data chunk before fmt chunk")
+			}
+			// spool files that were never finalized carry a zero size
+			if chunkSize == 0 {
+				chunkSize = math.MaxInt64
+			}
+			return format, chunkSize, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, chunkSize+chunkSize%2); err != nil {
+				return format, 0, err
+			}
+		}
+	}
+}
+
+func getSpoolDir() (string, error) {
+	spoolDir := filepath.Join(os.TempDir(), "storyshort_spool")
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return "", err
+	}
+	return spoolDir, nil
+}
+
+func spoolFileName(startTime time.Time) string {
+	return fmt.Sprintf("recording_%s.wav", startTime.Format("2006-01-02_15-04-05"))
+}
+
+// newSpoolPath returns a spool file in spoolDir for a recording started at
+// startTime. One started within the same second as the last, which may still
+// be being saved, gets a numbered name.
+func newSpoolPath(spoolDir string, startTime time.Time) string {
+	path := filepath.Join(spoolDir, spoolFileName(startTime))
+	for n := 2; fileExists(path); n++ {
+		path = filepath.Join(spoolDir, fmt.Sprintf("recording_%s_%d.wav", startTime.Format("2006-01-02_15-04-05"), n))
+	}
+	return path
+}
+
+// moveFile renames src to dst, falling back to copy and delete when the two
+// paths are on different filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
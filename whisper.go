@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/vadiminshakov/storyshort/gui"
+)
+
+// models that run on this machine are set as localModelPrefix followed by
+// their path
+const localModelPrefix = "local:"
+
+// whisper.cpp runs ggml model files, faster-whisper runs CTranslate2 model
+// directories; these are the command line tools each is installed as
+var (
+	whisperCppBinaries     = []string{"whisper-cli", "whisper-cpp"}
+	fasterWhisperBinaries  = []string{"whisper-ctranslate2", "faster-whisper"}
+	fasterWhisperModelFile = "model.bin"
+)
+
+func isLocalModel(model string) bool {
+	return strings.HasPrefix(model, localModelPrefix)
+}
+
+// ListLocalModels returns the models found at the whisper_model_path setting,
+// which is either a model or a directory of them.
+func (p *OpenAIProcessor) ListLocalModels() ([]gui.TranscriptionModel, error) {
+	path := p.config.GetWhisperModelPath()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if !info.IsDir() || isFasterWhisperModel(path) {
+		paths = append(paths, path)
+	} else {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			modelPath := filepath.Join(path, entry.Name())
+			if (entry.IsDir() && isFasterWhisperModel(modelPath)) || (!entry.IsDir() && filepath.Ext(entry.Name()) == ".bin") {
+				paths = append(paths, modelPath)
+			}
+		}
+	}
+
+	models := make([]gui.TranscriptionModel, len(paths))
+	for i, modelPath := range paths {
+		models[i] = gui.TranscriptionModel{
+			ID:      localModelPrefix + modelPath,
+			Name:    filepath.Base(modelPath),
+			Backend: "faster-whisper",
+		}
+		if !isFasterWhisperModel(modelPath) {
+			models[i].Name = strings.TrimSuffix(models[i].Name, ".bin")
+			models[i].Backend = "whisper.cpp"
+		}
+	}
+	return models, nil
+}
+
+func isFasterWhisperModel(path string) bool {
+	_, err := os.Stat(filepath.Join(path, fasterWhisperModelFile))
+	return err == nil
+}
+
+// whisperTranscriber runs a whisper.cpp or faster-whisper command line tool
+// on this machine, so audio never leaves it.
+type whisperTranscriber struct {
+	binary string
+	model  string
+	faster bool
+}
+
+func newWhisperTranscriber(config *Config, model string) (*whisperTranscriber, error) {
+	info, err := os.Stat(model)
+	if err != nil {
+		return nil, fmt.Errorf("local model: %w", err)
+	}
+	t := &whisperTranscriber{model: model, faster: info.IsDir()}
+
+	candidates := whisperCppBinaries
+	if t.faster {
+		candidates = fasterWhisperBinaries
+	}
+	if binary := config.GetWhisperBinary(); binary != "" {
+		candidates = []string{binary}
+	}
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			t.binary = path
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("no local transcription tool found (%s), set whisper_binary to its path", strings.Join(candidates, ", "))
+}
+
+func (t *whisperTranscriber) MaxFileSize() int64 {
+	return 0
+}
+
+func (t *whisperTranscriber) Transcribe(ctx context.Context, audioFile, language, prompt string) ([]transcriptSegment, error) {
+	outputDir, err := os.MkdirTemp("", "storyshort_whisper")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outputDir)
+
+	var args []string
+	var outputFile string
+	if t.faster {
+		args = []string{audioFile, "--model_directory", t.model, "--output_dir", outputDir, "--output_format", "json"}
+		if language != "auto" {
+			args = append(args, "--language", language)
+		}
+		if prompt != "" {
+			args = append(args, "--initial_prompt", prompt)
+		}
+		outputFile = filepath.Join(outputDir, strings.TrimSuffix(filepath.Base(audioFile), filepath.Ext(audioFile))+".json")
+	} else {
+		outputBase := filepath.Join(outputDir, "transcript")
+		args = []string{"-m", t.model, "-f", audioFile, "-l", language, "-oj", "-of", outputBase, "-np"}
+		if prompt != "" {
+			args = append(args, "--prompt", prompt)
+		}
+		outputFile = outputBase + ".json"
+	}
+
+	fmt.Printf("DEBUG: Transcribing %s locally with %s\n", filepath.Base(audioFile), filepath.Base(t.binary))
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.binary, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(t.binary), err, lastLine(stderr.String()))
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s wrote no transcript: %w", filepath.Base(t.binary), err)
+	}
+	return parseWhisperJSON(data)
+}
+
+// whisperOutput covers the JSON both tools write: whisper.cpp lists
+// transcription entries with offsets in milliseconds, faster-whisper follows
+// OpenAI's segments in seconds.
+type whisperOutput struct {
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"`
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+	Segments []transcriptSegment `json:"segments"`
+}
+
+func parseWhisperJSON(data []byte) ([]transcriptSegment, error) {
+	var output whisperOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("unreadable transcript: %w", err)
+	}
+
+	segments := output.Segments
+	for _, entry := range output.Transcription {
+		segments = append(segments, transcriptSegment{
+			Start: float64(entry.Offsets.From) / 1000,
+			End:   float64(entry.Offsets.To) / 1000,
+			Text:  entry.Text,
+		})
+	}
+	return segments, nil
+}
+
+// lastLine returns the last non-empty line of a tool's output, which is
+// usually the error.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}